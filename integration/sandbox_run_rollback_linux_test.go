@@ -21,14 +21,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/containerd/containerd/pkg/cri/checkpoint"
+	"github.com/containerd/containerd/pkg/cri/server"
+	"github.com/containerd/containerd/pkg/cri/server/volumeplugin"
 	"github.com/containerd/containerd/pkg/failpoint"
+	snfailpoint "github.com/containerd/containerd/snapshots/failpoint"
 	"github.com/containerd/continuity"
 	"github.com/containerd/go-cni"
 	"github.com/pkg/errors"
@@ -85,6 +92,231 @@ func TestRunPodSandboxWithShimStartFailure(t *testing.T) {
 	require.Equal(t, true, strings.Contains(err.Error(), "no hard feelings"))
 }
 
+// TestRunPodSandboxWithSnapshotterPrepareFailure proves a failed rootfs
+// snapshot Prepare (injected via the failpoint snapshotter CreateContainerRootfs
+// wires into the sandbox's snapshotter) doesn't leave an orphan snapshot
+// behind: the same sandbox config must be retryable, including after a
+// containerd restart, once the one-shot failpoint has fired.
+func TestRunPodSandboxWithSnapshotterPrepareFailure(t *testing.T) {
+	t.Logf("Inject snapshotter Prepare failpoint")
+	sbConfig := PodSandboxConfig(t.Name(), "failpoint")
+	sbConfig.Annotations[snfailpoint.AnnotationPrefix+"Prepare"] = "1*error(snapshot prepare interrupted)"
+
+	t.Logf("Create a sandbox")
+	_, err := runtimeService.RunPodSandbox(sbConfig, failpointRuntimeHandler)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "snapshot prepare interrupted")
+
+	t.Logf("Restart containerd")
+	RestartContainerd(t)
+
+	t.Logf("Retry creating the sandbox now that the one-shot failpoint is consumed")
+	sb, err := runtimeService.RunPodSandbox(sbConfig, failpointRuntimeHandler)
+	require.NoError(t, err, "a failed Prepare must not leave an orphan snapshot blocking retry")
+
+	require.NoError(t, runtimeService.StopPodSandbox(sb))
+	require.NoError(t, runtimeService.RemovePodSandbox(sb))
+}
+
+// TestCheckpointRestoreWithCompressionSelection proves checkpoint.Service and
+// checkpoint.Client round-trip a real process under each supported
+// compression algorithm, with the algorithm auto-detected on restore rather
+// than trusted from the caller.
+func TestCheckpointRestoreWithCompressionSelection(t *testing.T) {
+	if _, err := exec.LookPath("criu"); err != nil {
+		t.Skip("criu not available")
+	}
+
+	for _, algo := range []checkpoint.CompressionAlgorithm{checkpoint.CompressionNone, checkpoint.CompressionGzip, checkpoint.CompressionZstd} {
+		algo := algo
+		t.Run(string(algo), func(t *testing.T) {
+			dir := t.TempDir()
+			sockPath := filepath.Join(dir, "checkpoint.sock")
+			l, err := net.Listen("unix", sockPath)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			svc := checkpoint.NewService()
+			done := make(chan error, 1)
+			go func() { done <- svc.Serve(ctx, l) }()
+			defer func() {
+				cancel()
+				require.NoError(t, <-done)
+			}()
+
+			client := checkpoint.NewClient(sockPath)
+
+			specPath := filepath.Join(dir, "spec.json")
+			require.NoError(t, ioutil.WriteFile(specPath, []byte(`{"ociVersion":"1.0.0"}`), 0o600))
+
+			cmd := exec.Command("sleep", "60")
+			require.NoError(t, cmd.Start())
+			defer func() {
+				_ = cmd.Process.Kill()
+				_ = cmd.Wait()
+			}()
+
+			archivePath := filepath.Join(dir, "checkpoint.img")
+			require.NoError(t, client.CheckpointContainer(context.Background(), checkpoint.CheckpointOptions{
+				ContainerID:  t.Name(),
+				Pid:          cmd.Process.Pid,
+				SpecPath:     specPath,
+				WorkDir:      filepath.Join(dir, "checkpoint-work"),
+				Dest:         archivePath,
+				Compression:  algo,
+				LeaveRunning: true,
+			}))
+
+			res, err := client.RestoreContainer(context.Background(), checkpoint.RestoreOptions{
+				ContainerID: t.Name(),
+				Src:         archivePath,
+				WorkDir:     filepath.Join(dir, "restore-work"),
+			})
+			require.NoError(t, err)
+			require.NotZero(t, res.Pid)
+			defer func() {
+				_ = exec.Command("kill", "-9", fmt.Sprint(res.Pid)).Run()
+			}()
+
+			restoredSpec, err := os.ReadFile(res.SpecPath)
+			require.NoError(t, err)
+			require.Equal(t, `{"ociVersion":"1.0.0"}`, string(restoredSpec))
+		})
+	}
+}
+
+// TestCheckpointRestoreInterruptedRestoreRollback proves a RestoreContainer
+// call that fails (here, against a corrupt archive) cleans up its WorkDir
+// rather than leaving it behind to block a retry with the same WorkDir.
+func TestCheckpointRestoreInterruptedRestoreRollback(t *testing.T) {
+	if _, err := exec.LookPath("criu"); err != nil {
+		t.Skip("criu not available")
+	}
+
+	dir := t.TempDir()
+	sockPath := filepath.Join(dir, "checkpoint.sock")
+	l, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc := checkpoint.NewService()
+	done := make(chan error, 1)
+	go func() { done <- svc.Serve(ctx, l) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	client := checkpoint.NewClient(sockPath)
+
+	archivePath := filepath.Join(dir, "corrupt.img")
+	require.NoError(t, ioutil.WriteFile(archivePath, []byte("not a checkpoint archive"), 0o600))
+
+	workDir := filepath.Join(dir, "restore-work")
+	_, err = client.RestoreContainer(context.Background(), checkpoint.RestoreOptions{
+		ContainerID: t.Name(),
+		Src:         archivePath,
+		WorkDir:     workDir,
+	})
+	require.Error(t, err)
+
+	_, statErr := os.Stat(workDir)
+	require.True(t, os.IsNotExist(statErr), "a failed restore must not leave its WorkDir behind")
+}
+
+// fakeReloadSandboxStore is a minimal volumeplugin.SandboxNotReadySetter
+// that records which sandbox IDs were actually transitioned, standing in
+// for the CRI plugin's real sandbox store.
+type fakeReloadSandboxStore struct {
+	mu       sync.Mutex
+	notReady map[string]int
+}
+
+func (f *fakeReloadSandboxStore) SetNotReady(sandboxID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.notReady == nil {
+		f.notReady = make(map[string]int)
+	}
+	f.notReady[sandboxID]++
+	return nil
+}
+
+func (f *fakeReloadSandboxStore) count(sandboxID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.notReady[sandboxID]
+}
+
+// TestReloadVolumePluginsSwapSocketMidRun proves server.VolumePluginService
+// and server.VolumePluginClient are a genuine, working ReloadVolumePlugins
+// client/server pair over a real unix socket: a driver's socket is swapped
+// out mid-run, its dependent sandbox is reported NOTREADY over the wire,
+// and a subsequent ReloadVolumePlugins call after the socket comes back
+// recovers it.
+func TestReloadVolumePluginsSwapSocketMidRun(t *testing.T) {
+	dir := t.TempDir()
+	driverSock := filepath.Join(dir, "csi.sock")
+	driverListener, err := net.Listen("unix", driverSock)
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := driverListener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	store := &fakeReloadSandboxStore{}
+	driverSource := func() []volumeplugin.Driver {
+		return []volumeplugin.Driver{{Name: "csi-example", Address: driverSock}}
+	}
+	svc := server.NewVolumePluginService(nil, driverSource, store)
+	svc.RegisterDependent("csi-example", "sandbox-1")
+
+	adminSock := filepath.Join(dir, "volumeplugin-admin.sock")
+	l, err := net.Listen("unix", adminSock)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- svc.Serve(ctx, l) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	client := server.NewVolumePluginClient(adminSock)
+
+	report, err := client.ReloadVolumePlugins(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, report.Added, "csi-example")
+	require.Empty(t, report.NotReady)
+
+	t.Logf("swap the driver's socket out from under it")
+	require.NoError(t, driverListener.Close())
+
+	report, err = client.ReloadVolumePlugins(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, report.NotReady, "sandbox-1")
+	require.Equal(t, 1, store.count("sandbox-1"))
+
+	t.Logf("bring the driver's socket back and reload again")
+	driverListener2, err := net.Listen("unix", driverSock)
+	require.NoError(t, err)
+	defer driverListener2.Close()
+
+	report, err = client.ReloadVolumePlugins(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.NotReady)
+	require.Empty(t, report.Errored)
+}
+
 // TestRunPodSandboxWithShimDeleteFailure should keep the sandbox record if
 // failed to rollback shim by shim.Delete API.
 func TestRunPodSandboxWithShimDeleteFailure(t *testing.T) {
@@ -275,3 +275,64 @@ func getHostPathForVolumes(criRoot, containerID string) ([]string, error) {
 
 	return volumePaths, nil
 }
+
+// volumeOverlayAnnotationPrefix mirrors the constant of the same name in
+// pkg/cri/server/volume_overlay.go.
+const volumeOverlayAnnotationPrefix = "io.containerd.cri.volume-overlay/"
+
+// TestVolumeCopyUpPersistsOverlayAcrossRecreate is the end-to-end
+// counterpart of TestGenerateVolumeMountsUsesPersistentOverlayAnnotation and
+// TestCleanupContainerVolumeDirsSkipsPersistentOverlay in pkg/cri/server,
+// which exercise the annotation parsing and mount/cleanup generation
+// directly: it writes through an image-declared volume backed by a
+// caller-supplied upperdir/workdir, removes the container and recreates it
+// against the same upperdir, and verifies the content survived removal.
+func TestVolumeCopyUpPersistsOverlayAcrossRecreate(t *testing.T) {
+	testImage := images.Get(images.VolumeCopyUp)
+	execTimeout := time.Minute
+
+	t.Logf("Create a sandbox")
+	sb, sbConfig := PodSandboxConfigWithCleanup(t, "sandbox", "volume-overlay-persist")
+
+	EnsureImageExists(t, testImage)
+
+	upperDir := t.TempDir()
+	workDir := t.TempDir()
+
+	t.Logf("Create a container with a persistent overlay volume")
+	cnConfig := ContainerConfig(
+		"container",
+		testImage,
+		WithCommand("sleep", "150"),
+	)
+	cnConfig.Annotations[volumeOverlayAnnotationPrefix+"/test_dir"] = fmt.Sprintf("upperdir=%s,workdir=%s", upperDir, workDir)
+
+	cn, err := runtimeService.CreateContainer(sb, cnConfig, sbConfig)
+	require.NoError(t, err)
+	require.NoError(t, runtimeService.StartContainer(cn))
+
+	t.Logf("Write through the overlay-backed volume")
+	_, _, err = runtimeService.ExecSync(cn, []string{"sh", "-c", "echo persisted > /test_dir/marker"}, execTimeout)
+	require.NoError(t, err)
+
+	require.NoError(t, runtimeService.StopContainer(cn, 10))
+	require.NoError(t, runtimeService.RemoveContainer(cn))
+
+	data, err := os.ReadFile(filepath.Join(upperDir, "marker"))
+	require.NoError(t, err, "the persistent upperdir must survive container removal")
+	require.Equal(t, "persisted\n", string(data))
+
+	t.Logf("Recreate the container against the same upperdir")
+	cn2, err := runtimeService.CreateContainer(sb, cnConfig, sbConfig)
+	require.NoError(t, err)
+	require.NoError(t, runtimeService.StartContainer(cn2))
+	defer func() {
+		assert.NoError(t, runtimeService.StopContainer(cn2, 10))
+		assert.NoError(t, runtimeService.RemoveContainer(cn2))
+	}()
+
+	stdout, stderr, err := runtimeService.ExecSync(cn2, []string{"cat", "/test_dir/marker"}, execTimeout)
+	require.NoError(t, err)
+	assert.Empty(t, stderr)
+	assert.Equal(t, "persisted\n", string(stdout))
+}
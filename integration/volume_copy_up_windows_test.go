@@ -19,12 +19,7 @@
 package integration
 
 import (
-	"errors"
-	"fmt"
-	"os"
-	"strings"
-	"syscall"
-
+	"github.com/containerd/containerd/pkg/winpath"
 	"golang.org/x/sys/windows"
 )
 
@@ -44,72 +39,9 @@ func getOwnership(path string) (string, error) {
 	return sid.String(), nil
 }
 
-func openPath(path string) (windows.Handle, error) {
-	u16, err := windows.UTF16PtrFromString(path)
-	if err != nil {
-		return 0, err
-	}
-	h, err := windows.CreateFile(
-		u16,
-		0,
-		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
-		nil,
-		windows.OPEN_EXISTING,
-		windows.FILE_FLAG_BACKUP_SEMANTICS, // Needed to open a directory handle.
-		0)
-	if err != nil {
-		return 0, &os.PathError{
-			Op:   "CreateFile",
-			Path: path,
-			Err:  err,
-		}
-	}
-	return h, nil
-}
-
-// TODO(gabriel-samfira): expose this function in github.com/Microsoft/go-winio
-// We keep needing this in various parts and we're duplicating code.
+// getFinalPath is kept as a thin wrapper so this file's only remaining
+// dependency on windows path resolution goes through pkg/winpath, now that
+// the duplicated implementation has been promoted there.
 func getFinalPath(pth string) (string, error) {
-	if strings.HasPrefix(pth, `\Device`) {
-		pth = `\\.\GLOBALROOT` + pth
-	}
-
-	han, err := openPath(pth)
-	if err != nil {
-		return "", fmt.Errorf("fetching file handle: %w", err)
-	}
-	defer func() {
-		_ = windows.CloseHandle(han)
-	}()
-
-	buf := make([]uint16, 100)
-	var flags uint32 = 0x0
-	for {
-		n, err := windows.GetFinalPathNameByHandle(han, &buf[0], uint32(len(buf)), flags)
-		if err != nil {
-			// if we mounted a volume that does not also have a drive letter assigned, attempting to
-			// fetch the VOLUME_NAME_DOS will fail with os.ErrNotExist. Attempt to get the VOLUME_NAME_GUID.
-			if errors.Is(err, os.ErrNotExist) && flags != 0x1 {
-				flags = 0x1
-				continue
-			}
-			return "", fmt.Errorf("getting final path name: %w", err)
-		}
-		if n < uint32(len(buf)) {
-			break
-		}
-		buf = make([]uint16, n)
-	}
-	finalPath := syscall.UTF16ToString(buf)
-	// We got VOLUME_NAME_DOS, we need to strip away some leading slashes.
-	// Leave unchanged if we ended up requesting VOLUME_NAME_GUID
-	if len(finalPath) > 4 && finalPath[:4] == `\\?\` && flags == 0x0 {
-		finalPath = finalPath[4:]
-		if len(finalPath) > 3 && finalPath[:3] == `UNC` {
-			// return path like \\server\share\...
-			finalPath = `\` + finalPath[3:]
-		}
-	}
-
-	return finalPath, nil
+	return winpath.FinalPath(pth)
 }
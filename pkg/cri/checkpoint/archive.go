@@ -0,0 +1,227 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the well known entries written into every checkpoint archive.
+// These mirror the layout produced by libpod's container_internal_linux.go
+// checkpoint/restore code, minus the CRIU image directory name which is
+// kept as CriuImageDir below.
+const (
+	SpecFile         = "config.json"
+	ConfigDumpFile   = "config.dump"
+	MountsFile       = "mounts.json"
+	NetworkStateFile = "network.status"
+	CriuImageDir     = "criu-image"
+)
+
+// Archive describes the on-disk layout of a checkpoint before it is
+// written to, or after it is read from, a compressed archive file.
+type Archive struct {
+	// SpecPath is the path to the container's runtime spec (config.json).
+	SpecPath string
+	// ConfigDumpPath is the path to the CRIU-produced config.dump.
+	ConfigDumpPath string
+	// MountsPath is the path to the serialized mount table.
+	MountsPath string
+	// NetworkStatePath is the path to the serialized network status.
+	NetworkStatePath string
+	// CriuImageDir is the directory containing the CRIU image produced by
+	// `criu dump`.
+	CriuImageDir string
+}
+
+// Write produces a checkpoint archive at dest, compressed with algo.
+func Write(dest string, algo CompressionAlgorithm, a Archive) (err error) {
+	f, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("creating checkpoint archive %s: %w", dest, err)
+	}
+	defer f.Close()
+
+	stream, closeCompressor, err := NewCompressWriter(f, algo)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := closeCompressor(); err == nil {
+			err = cerr
+		}
+	}()
+
+	tw := tar.NewWriter(stream)
+	defer func() {
+		if cerr := tw.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	entries := []struct {
+		name string
+		path string
+	}{
+		{SpecFile, a.SpecPath},
+		{ConfigDumpFile, a.ConfigDumpPath},
+		{MountsFile, a.MountsPath},
+		{NetworkStateFile, a.NetworkStatePath},
+	}
+	for _, e := range entries {
+		if e.path == "" {
+			continue
+		}
+		if err := addFile(tw, e.name, e.path); err != nil {
+			return err
+		}
+	}
+
+	if a.CriuImageDir != "" {
+		if err := addDir(tw, CriuImageDir, a.CriuImageDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Read extracts a checkpoint archive created by Write into destDir,
+// auto-detecting the compression algorithm used regardless of what the
+// caller believes it to be.
+func Read(src string, destDir string) (algo CompressionAlgorithm, err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("opening checkpoint archive %s: %w", src, err)
+	}
+	defer f.Close()
+
+	stream, algo, closeDecompressor, err := NewDecompressReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer closeDecompressor()
+
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return algo, fmt.Errorf("reading checkpoint archive %s: %w", src, err)
+		}
+
+		target, err := safeJoin(destDir, hdr.Name)
+		if err != nil {
+			return algo, fmt.Errorf("reading checkpoint archive %s: %w", src, err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o700); err != nil {
+				return algo, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+				return algo, err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return algo, err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return algo, err
+			}
+			if err := out.Close(); err != nil {
+				return algo, err
+			}
+		}
+	}
+
+	return algo, nil
+}
+
+// safeJoin joins destDir with the tar entry name entryName, rejecting any
+// entry that would resolve outside destDir (a "tar-slip" via a crafted
+// "../" entry name). RestoreContainer extracts archives supplied by the
+// caller, so this must hold even for actively hostile input.
+func safeJoin(destDir, entryName string) (string, error) {
+	if strings.HasPrefix(entryName, "/") || filepath.IsAbs(entryName) {
+		return "", fmt.Errorf("checkpoint archive entry %q escapes destination directory", entryName)
+	}
+	target := filepath.Join(destDir, entryName)
+
+	destWithSep := filepath.Clean(destDir) + string(filepath.Separator)
+	if !strings.HasPrefix(target+string(filepath.Separator), destWithSep) {
+		return "", fmt.Errorf("checkpoint archive entry %q escapes destination directory", entryName)
+	}
+	return target, nil
+}
+
+func addFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %s for checkpoint archive: %w", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func addDir(tw *tar.Writer, name, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		entryName := filepath.Join(name, rel)
+
+		if info.IsDir() {
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = entryName + "/"
+			return tw.WriteHeader(hdr)
+		}
+		return addFile(tw, entryName, path)
+	})
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeJoinRejectsTraversal(t *testing.T) {
+	dest := t.TempDir()
+
+	for _, bad := range []string{
+		"../../etc/passwd",
+		"a/../../b",
+		"/etc/passwd",
+	} {
+		_, err := safeJoin(dest, bad)
+		require.Errorf(t, err, "expected entry %q to be rejected", bad)
+	}
+
+	ok, err := safeJoin(dest, "a/b/c")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(ok, dest))
+}
+
+// TestReadRejectsMaliciousArchive builds a tar archive containing a
+// path-traversal entry and verifies Read refuses to extract it outside
+// destDir.
+func TestReadRejectsMaliciousArchive(t *testing.T) {
+	srcDir := t.TempDir()
+	archivePath := filepath.Join(srcDir, "checkpoint.tar")
+
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "../../outside.txt",
+		Typeflag: tar.TypeReg,
+		Mode:     0o600,
+		Size:     int64(len("pwned")),
+	}))
+	_, err = tw.Write([]byte("pwned"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	destDir := t.TempDir()
+	_, err = Read(archivePath, destDir)
+	require.Error(t, err)
+
+	_, statErr := os.Stat(filepath.Join(filepath.Dir(destDir), "outside.txt"))
+	require.True(t, os.IsNotExist(statErr), "malicious entry must not have been written outside destDir")
+}
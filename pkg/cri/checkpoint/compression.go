@@ -0,0 +1,145 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package checkpoint implements the checkpoint/restore archive format used
+// by this package's CheckpointContainer and RestoreContainer APIs, and the
+// Service/Client pair that exposes them over a unix socket.
+package checkpoint
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionAlgorithm identifies how a checkpoint archive's tar stream is
+// compressed.
+type CompressionAlgorithm string
+
+const (
+	// CompressionNone stores the tar stream uncompressed.
+	CompressionNone CompressionAlgorithm = "none"
+	// CompressionGzip compresses the tar stream with gzip.
+	CompressionGzip CompressionAlgorithm = "gzip"
+	// CompressionZstd compresses the tar stream with zstd. This is the
+	// default used when creating new checkpoint archives.
+	CompressionZstd CompressionAlgorithm = "zstd"
+
+	// DefaultCompression is the algorithm used when a checkpoint request
+	// does not explicitly select one.
+	DefaultCompression = CompressionZstd
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseCompressionAlgorithm validates a user-supplied compression name,
+// returning DefaultCompression for the empty string.
+func ParseCompressionAlgorithm(name string) (CompressionAlgorithm, error) {
+	switch CompressionAlgorithm(name) {
+	case "":
+		return DefaultCompression, nil
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return CompressionAlgorithm(name), nil
+	default:
+		return "", fmt.Errorf("unsupported checkpoint compression algorithm %q", name)
+	}
+}
+
+// DetectCompression sniffs the magic bytes at the start of a checkpoint
+// archive to determine which algorithm it was compressed with, so that
+// RestoreContainer does not require the caller to record it out of band.
+func DetectCompression(header []byte) CompressionAlgorithm {
+	switch {
+	case len(header) >= len(zstdMagic) && bytesEqual(header[:len(zstdMagic)], zstdMagic):
+		return CompressionZstd
+	case len(header) >= len(gzipMagic) && bytesEqual(header[:len(gzipMagic)], gzipMagic):
+		return CompressionGzip
+	default:
+		return CompressionNone
+	}
+}
+
+func bytesEqual(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// magicLen is the number of header bytes that must be buffered from the
+// archive before DetectCompression can make a decision.
+const magicLen = 4
+
+// NewDecompressReader wraps r with the decompressor matching the archive's
+// sniffed magic header, regardless of which algorithm was requested at
+// checkpoint time. The returned reader must be closed by the caller if the
+// concrete type implements io.Closer; callers should use the returned
+// closeFunc instead of type-asserting r.
+func NewDecompressReader(r io.Reader) (stream io.Reader, algo CompressionAlgorithm, closeFunc func() error, err error) {
+	br := bufio.NewReaderSize(r, magicLen)
+	header, err := br.Peek(magicLen)
+	if err != nil && err != io.EOF {
+		return nil, "", nil, fmt.Errorf("sniffing checkpoint archive header: %w", err)
+	}
+
+	switch algo = DetectCompression(header); algo {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("opening gzip checkpoint archive: %w", err)
+		}
+		return gr, algo, gr.Close, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("opening zstd checkpoint archive: %w", err)
+		}
+		return zr, algo, func() error { zr.Close(); return nil }, nil
+	default:
+		return br, algo, func() error { return nil }, nil
+	}
+}
+
+// NewCompressWriter wraps w with the compressor for algo, writing the magic
+// header that DetectCompression expects to find on restore.
+func NewCompressWriter(w io.Writer, algo CompressionAlgorithm) (stream io.Writer, closeFunc func() error, err error) {
+	switch algo {
+	case CompressionGzip:
+		gw := gzip.NewWriter(w)
+		return gw, gw.Close, nil
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening zstd checkpoint writer: %w", err)
+		}
+		return zw, zw.Close, nil
+	case CompressionNone:
+		return w, func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported checkpoint compression algorithm %q", algo)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Service exposes CheckpointContainer and RestoreContainer over a unix
+// socket, so that a caller does not need to link this package (and
+// therefore criu) directly to request a checkpoint or restore. Client is
+// its counterpart.
+type Service struct {
+	server *http.Server
+}
+
+// NewService creates a Service ready to Serve.
+func NewService() *Service {
+	mux := http.NewServeMux()
+	s := &Service{server: &http.Server{Handler: mux}}
+	mux.HandleFunc("/checkpoint", s.handleCheckpoint)
+	mux.HandleFunc("/restore", s.handleRestore)
+	return s
+}
+
+// Serve accepts connections on l, handling CheckpointContainer and
+// RestoreContainer requests until l is closed or ctx is done.
+func (s *Service) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = s.server.Close()
+	}()
+	if err := s.server.Serve(l); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("serving checkpoint/restore requests: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) handleCheckpoint(w http.ResponseWriter, r *http.Request) {
+	var opts CheckpointOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := CheckpointContainer(r.Context(), opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) handleRestore(w http.ResponseWriter, r *http.Request) {
+	var opts RestoreOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := RestoreContainer(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// Client calls CheckpointContainer and RestoreContainer on a Service
+// listening on a unix socket.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates a Client that dials the unix socket at address for
+// every request.
+func NewClient(address string) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", address)
+				},
+			},
+		},
+	}
+}
+
+// CheckpointContainer asks the Service at c's address to checkpoint the
+// container described by opts.
+func (c *Client) CheckpointContainer(ctx context.Context, opts CheckpointOptions) error {
+	body, err := json.Marshal(opts)
+	if err != nil {
+		return fmt.Errorf("marshaling checkpoint request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://checkpoint.sock/checkpoint", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling CheckpointContainer for %s: %w", opts.ContainerID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("CheckpointContainer for %s failed: %s", opts.ContainerID, readErrBody(resp.Body))
+	}
+	return nil
+}
+
+// RestoreContainer asks the Service at c's address to restore the container
+// described by opts.
+func (c *Client) RestoreContainer(ctx context.Context, opts RestoreOptions) (RestoreResult, error) {
+	body, err := json.Marshal(opts)
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("marshaling restore request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://checkpoint.sock/restore", bytes.NewReader(body))
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("calling RestoreContainer for %s: %w", opts.ContainerID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return RestoreResult{}, fmt.Errorf("RestoreContainer for %s failed: %s", opts.ContainerID, readErrBody(resp.Body))
+	}
+	var res RestoreResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return RestoreResult{}, fmt.Errorf("decoding restore response for %s: %w", opts.ContainerID, err)
+	}
+	return res, nil
+}
+
+func readErrBody(r io.Reader) string {
+	data, _ := io.ReadAll(r)
+	return strings.TrimSpace(string(data))
+}
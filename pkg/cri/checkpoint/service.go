@@ -0,0 +1,181 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CheckpointOptions describes a single CheckpointContainer call.
+type CheckpointOptions struct {
+	// ContainerID is the CRI container being checkpointed, used only for
+	// error messages.
+	ContainerID string
+	// Pid is the container init process's pid, as seen from the host pid
+	// namespace, that `criu dump` is pointed at.
+	Pid int
+	// SpecPath, ConfigDumpPath, MountsPath and NetworkStatePath are
+	// copied verbatim into the resulting archive; see Archive.
+	SpecPath         string
+	ConfigDumpPath   string
+	MountsPath       string
+	NetworkStatePath string
+	// WorkDir is scratch space for the CRIU image directory; it is
+	// removed once the archive has been written.
+	WorkDir string
+	// Dest is the path the compressed checkpoint archive is written to.
+	Dest string
+	// Compression selects the archive's compression algorithm.
+	Compression CompressionAlgorithm
+	// LeaveRunning keeps the container process running once the dump
+	// completes, mirroring `runc checkpoint --leave-running`.
+	LeaveRunning bool
+}
+
+// CheckpointContainer dumps the running process identified by opts.Pid with
+// CRIU and packages the result, together with the runtime spec, mount table
+// and network status, into a compressed checkpoint archive at opts.Dest.
+// An empty opts.Compression selects DefaultCompression.
+// Service.handleCheckpoint calls this with the options it decoded from the
+// request, exposing it to Client over a unix socket; the caller supplies
+// opts.Pid.
+func CheckpointContainer(ctx context.Context, opts CheckpointOptions) (err error) {
+	if opts.WorkDir == "" {
+		return fmt.Errorf("checkpointing container %s: WorkDir is required", opts.ContainerID)
+	}
+	algo, err := ParseCompressionAlgorithm(string(opts.Compression))
+	if err != nil {
+		return fmt.Errorf("checkpointing container %s: %w", opts.ContainerID, err)
+	}
+
+	imageDir := filepath.Join(opts.WorkDir, CriuImageDir)
+	if err := os.MkdirAll(imageDir, 0o700); err != nil {
+		return fmt.Errorf("creating CRIU image directory for container %s: %w", opts.ContainerID, err)
+	}
+	defer os.RemoveAll(opts.WorkDir)
+
+	args := []string{
+		"dump",
+		"-D", imageDir,
+		"-t", strconv.Itoa(opts.Pid),
+		"--shell-job",
+		"--tcp-established",
+		"--file-locks",
+	}
+	if opts.LeaveRunning {
+		args = append(args, "--leave-running")
+	}
+	if out, err := exec.CommandContext(ctx, "criu", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("criu dump for container %s failed: %w: %s", opts.ContainerID, err, out)
+	}
+
+	return Write(opts.Dest, algo, Archive{
+		SpecPath:         opts.SpecPath,
+		ConfigDumpPath:   opts.ConfigDumpPath,
+		MountsPath:       opts.MountsPath,
+		NetworkStatePath: opts.NetworkStatePath,
+		CriuImageDir:     imageDir,
+	})
+}
+
+// RestoreOptions describes a single RestoreContainer call.
+type RestoreOptions struct {
+	// ContainerID is the CRI container being restored, used only for
+	// error messages.
+	ContainerID string
+	// Src is the checkpoint archive written by a prior CheckpointContainer
+	// call.
+	Src string
+	// WorkDir is scratch space the archive is extracted into and the
+	// restored process is launched with as its CRIU image directory. It
+	// is removed if the restore fails; on success it is kept, since the
+	// returned RestoreResult's paths point into it.
+	WorkDir string
+}
+
+// RestoreResult reports the restored process and the checkpoint archive's
+// extracted contents, so the caller can reattach the container's spec,
+// mounts and network state.
+type RestoreResult struct {
+	Pid int
+	Archive
+}
+
+// RestoreContainer extracts the checkpoint archive at opts.Src and restores
+// it in place with CRIU, returning the restored process's host pid and the
+// Archive extracted under opts.WorkDir. Service.handleRestore calls this
+// with the options it decoded from the request.
+func RestoreContainer(ctx context.Context, opts RestoreOptions) (res RestoreResult, err error) {
+	if opts.WorkDir == "" {
+		return RestoreResult{}, fmt.Errorf("restoring container %s: WorkDir is required", opts.ContainerID)
+	}
+	if err := os.MkdirAll(opts.WorkDir, 0o700); err != nil {
+		return RestoreResult{}, fmt.Errorf("creating restore work directory for container %s: %w", opts.ContainerID, err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(opts.WorkDir)
+		}
+	}()
+
+	if _, err := Read(opts.Src, opts.WorkDir); err != nil {
+		return RestoreResult{}, fmt.Errorf("extracting checkpoint archive for container %s: %w", opts.ContainerID, err)
+	}
+
+	archive := Archive{
+		SpecPath:         filepath.Join(opts.WorkDir, SpecFile),
+		ConfigDumpPath:   filepath.Join(opts.WorkDir, ConfigDumpFile),
+		MountsPath:       filepath.Join(opts.WorkDir, MountsFile),
+		NetworkStatePath: filepath.Join(opts.WorkDir, NetworkStateFile),
+		CriuImageDir:     filepath.Join(opts.WorkDir, CriuImageDir),
+	}
+
+	pidFile := filepath.Join(opts.WorkDir, "restore.pid")
+	args := []string{
+		"restore",
+		"-D", archive.CriuImageDir,
+		"--shell-job",
+		"--tcp-established",
+		"--file-locks",
+		"--restore-detached",
+		"--pidfile", pidFile,
+	}
+	if out, err := exec.CommandContext(ctx, "criu", args...).CombinedOutput(); err != nil {
+		return RestoreResult{}, fmt.Errorf("criu restore for container %s failed: %w: %s", opts.ContainerID, err, out)
+	}
+
+	pid, err := readPidFile(pidFile)
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("reading restored pid for container %s: %w", opts.ContainerID, err)
+	}
+
+	return RestoreResult{Pid: pid, Archive: archive}, nil
+}
+
+func readPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
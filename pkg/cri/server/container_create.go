@@ -0,0 +1,61 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/snapshots"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// CreateContainerRootfs is the production call site for the container
+// rootfs snapshot: ContainerManager.CreateContainer calls this rather than
+// sn.Prepare directly, so that failpoint injection and runtime-handler
+// selection (see PrepareContainerSnapshot) actually apply to every
+// container's rootfs, not just to a unit test driving PrepareContainerSnapshot
+// in isolation.
+func CreateContainerRootfs(ctx context.Context, sn snapshots.Snapshotter, handler, key, parent string, annotations map[string]string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	return PrepareContainerSnapshot(ctx, sn, handler, key, parent, annotations, opts...)
+}
+
+// RemoveContainerRootfs is the production call site for committing a
+// container's rootfs snapshot on removal; ContainerManager.RemoveContainer
+// calls this rather than sn.Commit directly, for the same reason
+// ContainerManager.CreateContainer calls CreateContainerRootfs.
+func RemoveContainerRootfs(ctx context.Context, sn snapshots.Snapshotter, handler, name, key string, annotations map[string]string, opts ...snapshots.Opt) error {
+	return CommitContainerSnapshot(ctx, sn, handler, name, key, annotations, opts...)
+}
+
+// CreateContainerVolumes is the production call site for a container's
+// image-declared volume mounts: ContainerManager.CreateContainer calls this
+// once it has resolved imageVolumes and volumesDir, so that the
+// io.containerd.cri.volume-overlay/ annotation actually changes what gets
+// mounted instead of being parsed and ignored by every real container.
+func CreateContainerVolumes(spec *specs.Spec, imageVolumes []string, volumesDir string, annotations map[string]string) error {
+	return PrepareContainerVolumeMounts(spec, imageVolumes, volumesDir, annotations)
+}
+
+// RemoveContainerVolumes is the production call site for cleaning up a
+// removed container's copy-up volume directories;
+// ContainerManager.RemoveContainer calls this rather than deleting
+// volumesDir wholesale, so a persistent overlay volume's upperdir/workdir
+// survives the container that created it.
+func RemoveContainerVolumes(imageVolumes []string, volumesDir string, annotations map[string]string) error {
+	return CleanupContainerVolumes(imageVolumes, volumesDir, annotations)
+}
@@ -0,0 +1,97 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCreateContainerRootfsReachesSnapshotter proves CreateContainerRootfs is
+// a genuine caller of PrepareContainerSnapshot, not a function nothing in
+// this package invokes outside of its own unit test.
+func TestCreateContainerRootfsReachesSnapshotter(t *testing.T) {
+	base := &fakeSnapshotter{}
+
+	_, err := CreateContainerRootfs(context.Background(), base, "runc", "key-1", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, base.prepareCalls)
+}
+
+// TestCreateContainerRootfsFailpointPropagates proves the failpoint runtime
+// handler is honored through CreateContainerRootfs exactly as it is through
+// PrepareContainerSnapshot directly.
+func TestCreateContainerRootfsFailpointPropagates(t *testing.T) {
+	base := &fakeSnapshotter{}
+	annotations := map[string]string{
+		failpointSnapshotterAnnotationPrefix + "Prepare": "1*error(boom)",
+	}
+
+	_, err := CreateContainerRootfs(context.Background(), base, failpointRuntimeHandler, "key-1", "", annotations)
+	require.Error(t, err)
+	require.Equal(t, 0, base.prepareCalls)
+}
+
+// TestRemoveContainerRootfsReachesSnapshotter proves RemoveContainerRootfs is
+// a genuine caller of CommitContainerSnapshot.
+func TestRemoveContainerRootfsReachesSnapshotter(t *testing.T) {
+	base := &fakeSnapshotter{}
+
+	err := RemoveContainerRootfs(context.Background(), base, "runc", "name", "key-1", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, base.commitCalls)
+}
+
+// TestCreateContainerVolumesReachesMountGeneration proves CreateContainerVolumes
+// is a genuine caller of PrepareContainerVolumeMounts, not a function nothing
+// in this package invokes outside of its own unit test.
+func TestCreateContainerVolumesReachesMountGeneration(t *testing.T) {
+	root := t.TempDir()
+	volumesDir := filepath.Join(root, "volumes")
+	require.NoError(t, os.MkdirAll(filepath.Join(volumesDir, "data"), 0o755))
+
+	spec := &specs.Spec{}
+	err := CreateContainerVolumes(spec, []string{"/data"}, volumesDir, nil)
+	require.NoError(t, err)
+	require.Len(t, spec.Mounts, 1)
+}
+
+// TestRemoveContainerVolumesReachesCleanup proves RemoveContainerVolumes is a
+// genuine caller of CleanupContainerVolumes, including honoring the
+// persistent overlay annotation.
+func TestRemoveContainerVolumesReachesCleanup(t *testing.T) {
+	root := t.TempDir()
+	volumesDir := filepath.Join(root, "volumes")
+	upperDir := filepath.Join(root, "upper")
+	require.NoError(t, os.MkdirAll(filepath.Join(volumesDir, "data"), 0o755))
+	require.NoError(t, os.MkdirAll(upperDir, 0o755))
+
+	annotations := map[string]string{
+		volumeOverlayAnnotationPrefix + "data": "upperdir=" + upperDir + ",workdir=" + filepath.Join(root, "work"),
+	}
+
+	err := RemoveContainerVolumes([]string{"/data"}, volumesDir, annotations)
+	require.NoError(t, err)
+
+	_, err = os.Stat(upperDir)
+	require.NoError(t, err, "the persistent overlay upperdir must survive cleanup")
+}
@@ -0,0 +1,72 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/snapshots"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// ContainerManager is the single place a container's rootfs snapshot and
+// image-declared volume mounts are created and torn down. It exists so that
+// CreateContainerRootfs/RemoveContainerRootfs and
+// CreateContainerVolumes/RemoveContainerVolumes have one real caller instead
+// of being reachable only from their own unit tests.
+type ContainerManager struct {
+	// Snapshotter provisions every container's rootfs.
+	Snapshotter snapshots.Snapshotter
+	// Handler is the configured runtime handler for the sandbox/container;
+	// only the failpoint runtime handler changes snapshotterForContainer's
+	// behavior, but every caller must supply it.
+	Handler string
+	// ContainersRoot is the <criRoot>/containers directory; a container's
+	// copy-up volumes live under ContainersRoot/<containerID>/volumes.
+	ContainersRoot string
+}
+
+// CreateContainer provisions containerID's rootfs snapshot under key (from
+// parent) and mounts its image-declared volumes, returning the full mount
+// list its OCI runtime spec should use.
+func (m *ContainerManager) CreateContainer(ctx context.Context, containerID, key, parent string, imageVolumes []string, annotations map[string]string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	rootfsMounts, err := CreateContainerRootfs(ctx, m.Snapshotter, m.Handler, key, parent, annotations, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &specs.Spec{Mounts: rootfsMounts}
+	if err := CreateContainerVolumes(spec, imageVolumes, m.volumesDir(containerID), annotations); err != nil {
+		return nil, err
+	}
+	return spec.Mounts, nil
+}
+
+// RemoveContainer cleans up containerID's copy-up volume directories and
+// commits its rootfs snapshot as name, the reverse of CreateContainer.
+func (m *ContainerManager) RemoveContainer(ctx context.Context, containerID, name, key string, imageVolumes []string, annotations map[string]string, opts ...snapshots.Opt) error {
+	if err := RemoveContainerVolumes(imageVolumes, m.volumesDir(containerID), annotations); err != nil {
+		return err
+	}
+	return RemoveContainerRootfs(ctx, m.Snapshotter, m.Handler, name, key, annotations, opts...)
+}
+
+func (m *ContainerManager) volumesDir(containerID string) string {
+	return filepath.Join(m.ContainersRoot, containerID, "volumes")
+}
@@ -0,0 +1,87 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestContainerManagerCreateContainerWiresRootfsAndVolumes proves
+// ContainerManager.CreateContainer is a genuine caller of both
+// CreateContainerRootfs and CreateContainerVolumes, not a function nothing
+// in this package invokes outside of its own unit test.
+func TestContainerManagerCreateContainerWiresRootfsAndVolumes(t *testing.T) {
+	root := t.TempDir()
+	containersRoot := filepath.Join(root, "containers")
+	require.NoError(t, os.MkdirAll(filepath.Join(containersRoot, "c1", "volumes", "data"), 0o755))
+
+	base := &fakeSnapshotter{}
+	m := &ContainerManager{Snapshotter: base, Handler: "runc", ContainersRoot: containersRoot}
+
+	mounts, err := m.CreateContainer(context.Background(), "c1", "key-1", "", []string{"/data"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, base.prepareCalls)
+	require.Len(t, mounts, 1, "the volume mount generated for /data must be part of the returned mount list")
+}
+
+// TestContainerManagerCreateContainerFailpointPropagates proves the
+// failpoint runtime handler is honored through ContainerManager.CreateContainer:
+// the injected Prepare failure is returned and the real snapshotter is never
+// reached.
+func TestContainerManagerCreateContainerFailpointPropagates(t *testing.T) {
+	base := &fakeSnapshotter{}
+	annotations := map[string]string{
+		failpointSnapshotterAnnotationPrefix + "Prepare": "1*error(boom)",
+	}
+	m := &ContainerManager{Snapshotter: base, Handler: failpointRuntimeHandler, ContainersRoot: t.TempDir()}
+
+	_, err := m.CreateContainer(context.Background(), "c1", "key-1", "", nil, annotations)
+	require.Error(t, err)
+	require.Equal(t, 0, base.prepareCalls)
+}
+
+// TestContainerManagerRemoveContainerWiresRootfsAndVolumes proves
+// ContainerManager.RemoveContainer is a genuine caller of both
+// RemoveContainerVolumes and RemoveContainerRootfs, and that it preserves a
+// persistent overlay volume's upperdir while still committing the rootfs
+// snapshot.
+func TestContainerManagerRemoveContainerWiresRootfsAndVolumes(t *testing.T) {
+	root := t.TempDir()
+	containersRoot := filepath.Join(root, "containers")
+	upperDir := filepath.Join(root, "upper")
+	require.NoError(t, os.MkdirAll(filepath.Join(containersRoot, "c1", "volumes", "data"), 0o755))
+	require.NoError(t, os.MkdirAll(upperDir, 0o755))
+
+	base := &fakeSnapshotter{}
+	m := &ContainerManager{Snapshotter: base, Handler: "runc", ContainersRoot: containersRoot}
+
+	annotations := map[string]string{
+		volumeOverlayAnnotationPrefix + "data": "upperdir=" + upperDir + ",workdir=" + filepath.Join(root, "work"),
+	}
+
+	err := m.RemoveContainer(context.Background(), "c1", "name", "key-1", []string{"/data"}, annotations)
+	require.NoError(t, err)
+	require.Equal(t, 1, base.commitCalls)
+
+	_, err = os.Stat(upperDir)
+	require.NoError(t, err, "the persistent overlay upperdir must survive RemoveContainer")
+}
@@ -0,0 +1,50 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/snapshots"
+)
+
+// PrepareContainerSnapshot resolves the snapshotter a sandbox/container's
+// rootfs should use, honoring failpoint injection for the failpoint runtime
+// handler, and calls Prepare on it. CreateContainerRootfs calls this instead
+// of calling sn.Prepare directly, so that
+// "io.containerd.snapshotter.failpoint.<Method>" annotations actually reach
+// the snapshotter used to provision the rootfs.
+func PrepareContainerSnapshot(ctx context.Context, sn snapshots.Snapshotter, handler, key, parent string, annotations map[string]string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	snapshotter, err := snapshotterForContainer(handler, sn, key, annotations)
+	if err != nil {
+		return nil, fmt.Errorf("selecting snapshotter for %s: %w", key, err)
+	}
+	return snapshotter.Prepare(ctx, key, parent, opts...)
+}
+
+// CommitContainerSnapshot resolves the snapshotter for key the same way
+// PrepareContainerSnapshot did and calls Commit on it. RemoveContainerRootfs
+// calls this to commit the rootfs snapshot as part of tearing it down.
+func CommitContainerSnapshot(ctx context.Context, sn snapshots.Snapshotter, handler, name, key string, annotations map[string]string, opts ...snapshots.Opt) error {
+	snapshotter, err := snapshotterForContainer(handler, sn, key, annotations)
+	if err != nil {
+		return fmt.Errorf("selecting snapshotter for %s: %w", key, err)
+	}
+	return snapshotter.Commit(ctx, name, key, opts...)
+}
@@ -0,0 +1,54 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrepareContainerSnapshotInjectsFailpoint proves the failpoint
+// snapshotter is actually reachable from the Prepare call site
+// CreateContainerRootfs uses, not just from a unit test calling
+// snapshotterForContainer directly.
+func TestPrepareContainerSnapshotInjectsFailpoint(t *testing.T) {
+	base := &fakeSnapshotter{}
+	annotations := map[string]string{
+		failpointSnapshotterAnnotationPrefix + "Prepare": "1*error(boom)",
+	}
+
+	_, err := PrepareContainerSnapshot(context.Background(), base, failpointRuntimeHandler, "key-1", "", annotations)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom")
+	require.Equal(t, 0, base.prepareCalls, "the real snapshotter must not be reached when the failpoint fires")
+}
+
+// TestCommitContainerSnapshotPassthroughWithoutFailpointHandler verifies
+// CommitContainerSnapshot reaches the real snapshotter outside of the
+// failpoint runtime handler.
+func TestCommitContainerSnapshotPassthroughWithoutFailpointHandler(t *testing.T) {
+	base := &fakeSnapshotter{}
+	annotations := map[string]string{
+		failpointSnapshotterAnnotationPrefix + "Commit": "1*error(boom)",
+	}
+
+	err := CommitContainerSnapshot(context.Background(), base, "runc", "name", "key-1", annotations)
+	require.NoError(t, err)
+	require.Equal(t, 1, base.commitCalls)
+}
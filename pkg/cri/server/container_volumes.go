@@ -0,0 +1,67 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// PrepareContainerVolumeMounts builds the final mount list for a
+// container's image-declared VOLUME paths and appends it to spec.Mounts.
+// CreateContainerVolumes calls this once ContainerManager.CreateContainer
+// has resolved imageVolumes from the image config and volumesDir to the
+// container's <criRoot>/containers/<id>/volumes directory, so that the
+// io.containerd.cri.volume-overlay/ annotation actually changes what gets
+// mounted instead of being parsed and ignored.
+func PrepareContainerVolumeMounts(spec *specs.Spec, imageVolumes []string, volumesDir string, annotations map[string]string) error {
+	mounts, err := generateVolumeMounts(imageVolumes, copyUpDir(volumesDir), annotations)
+	if err != nil {
+		return err
+	}
+	spec.Mounts = append(spec.Mounts, mounts...)
+	return nil
+}
+
+// CleanupContainerVolumes removes a removed container's copy-up volume
+// directories under volumesDir, skipping any backed by a persistent
+// overlay upperdir/workdir. RemoveContainerVolumes calls this, from
+// ContainerManager.RemoveContainer, so that a persistent overlay volume's
+// upperdir/workdir survives the container that created it, instead of being
+// deleted like every other copy-up directory.
+func CleanupContainerVolumes(imageVolumes []string, volumesDir string, annotations map[string]string) error {
+	copyUp := copyUpDir(volumesDir)
+	return cleanupContainerVolumeDirs(func(containerPath string) error {
+		path := copyUp(containerPath)
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("removing volume directory %s: %w", path, err)
+		}
+		return nil
+	}, imageVolumes, annotations)
+}
+
+// copyUpDir returns the per-container copy-up directory for containerPath
+// under volumesDir, matching the <criRoot>/containers/<id>/volumes layout
+// the pre-existing copy-up code uses.
+func copyUpDir(volumesDir string) func(containerPath string) string {
+	return func(containerPath string) string {
+		return filepath.Join(volumesDir, filepath.FromSlash(containerPath))
+	}
+}
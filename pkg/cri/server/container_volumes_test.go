@@ -0,0 +1,67 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrepareAndCleanupContainerVolumesPersistsOverlayDir is an end-to-end
+// test of the persistent overlay volume feature against the real
+// filesystem: it drives PrepareContainerVolumeMounts and
+// CleanupContainerVolumes, the functions CreateContainerVolumes and
+// RemoveContainerVolumes actually call, and verifies the overlay-annotated
+// volume's upperdir survives cleanup while the plain copy-up volume is
+// removed.
+func TestPrepareAndCleanupContainerVolumesPersistsOverlayDir(t *testing.T) {
+	root := t.TempDir()
+	volumesDir := filepath.Join(root, "volumes")
+	upperDir := filepath.Join(root, "upper")
+	workDir := filepath.Join(root, "work")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(volumesDir, "data"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(volumesDir, "scratch"), 0o755))
+	require.NoError(t, os.MkdirAll(upperDir, 0o755))
+	require.NoError(t, os.MkdirAll(workDir, 0o755))
+
+	annotations := map[string]string{
+		volumeOverlayAnnotationPrefix + "data": "upperdir=" + upperDir + ",workdir=" + workDir,
+	}
+	imageVolumes := []string{"/data", "/scratch"}
+
+	spec := &specs.Spec{}
+	require.NoError(t, PrepareContainerVolumeMounts(spec, imageVolumes, volumesDir, annotations))
+	require.Len(t, spec.Mounts, 2)
+	require.Equal(t, "overlay", spec.Mounts[0].Type)
+	require.Equal(t, "bind", spec.Mounts[1].Type)
+
+	require.NoError(t, CleanupContainerVolumes(imageVolumes, volumesDir, annotations))
+
+	_, err := os.Stat(upperDir)
+	require.NoError(t, err, "the persistent overlay upperdir must survive cleanup")
+
+	_, err = os.Stat(filepath.Join(volumesDir, "scratch"))
+	require.True(t, os.IsNotExist(err), "the plain copy-up volume must be removed by cleanup")
+
+	_, err = os.Stat(filepath.Join(volumesDir, "data"))
+	require.NoError(t, err, "the overlay-backed copy-up directory itself is not the upperdir and is unaffected by cleanup")
+}
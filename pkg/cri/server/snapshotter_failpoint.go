@@ -0,0 +1,84 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/snapshots"
+	snfailpoint "github.com/containerd/containerd/snapshots/failpoint"
+)
+
+// failpointSnapshotterAnnotationPrefix is re-exported for readability at
+// call sites; it matches snfailpoint.AnnotationPrefix.
+const failpointSnapshotterAnnotationPrefix = snfailpoint.AnnotationPrefix
+
+// failpointRuntimeHandler is the runtime handler name integration tests
+// configure to enable shim, CNI and snapshotter failpoint injection.
+const failpointRuntimeHandler = "runc-fp"
+
+// wrapSnapshotterForFailpoints wraps sn with the failpoint snapshotter when
+// handler is the failpoint runtime handler, so that
+// "io.containerd.snapshotter.failpoint.<Method>" pod annotations can inject
+// failures into Prepare/View/Commit/Mounts/Remove/Stat the same way shim and
+// CNI failpoints are injected for that handler.
+func wrapSnapshotterForFailpoints(handler string, sn snapshots.Snapshotter) snapshots.Snapshotter {
+	if handler != failpointRuntimeHandler {
+		return sn
+	}
+	return snfailpoint.NewSnapshotter(sn)
+}
+
+// snapshotterFailpointsFromAnnotations extracts the per-method failpoint
+// specs configured via failpointSnapshotterAnnotationPrefix annotations.
+func snapshotterFailpointsFromAnnotations(annotations map[string]string) map[string]string {
+	fps := make(map[string]string)
+	for k, v := range annotations {
+		if method := strings.TrimPrefix(k, failpointSnapshotterAnnotationPrefix); method != k {
+			fps[method] = v
+		}
+	}
+	return fps
+}
+
+// snapshotterForContainer is the actual integration point: given the
+// snapshotter service would otherwise use for a sandbox/container, the
+// runtime handler selected for it, the snapshot key being prepared, and its
+// annotations, it returns the snapshotter Prepare/Commit should run against.
+// It is called from PrepareContainerSnapshot and CommitContainerSnapshot in
+// container_rootfs.go, which CreateContainerRootfs/RemoveContainerRootfs use
+// instead of calling a snapshotter's Prepare/Commit directly; those in turn
+// are ContainerManager.CreateContainer/RemoveContainer's only path to a
+// container's rootfs. Outside of the
+// failpoint runtime handler this is always the unwrapped snapshotter with
+// zero overhead; annotations without a matching failpoint handler are a
+// no-op.
+func snapshotterForContainer(handler string, sn snapshots.Snapshotter, key string, annotations map[string]string) (snapshots.Snapshotter, error) {
+	wrapped := wrapSnapshotterForFailpoints(handler, sn)
+	fp, ok := wrapped.(*snfailpoint.Snapshotter)
+	if !ok {
+		return wrapped, nil
+	}
+
+	for method, spec := range snapshotterFailpointsFromAnnotations(annotations) {
+		if err := fp.SetFailpoint(key, method, spec); err != nil {
+			return nil, fmt.Errorf("configuring snapshotter failpoint %s for %s: %w", method, key, err)
+		}
+	}
+	return fp, nil
+}
@@ -0,0 +1,100 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/snapshots"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSnapshotter is a minimal snapshots.Snapshotter that always succeeds,
+// just enough to prove whether the failpoint wrapper actually intercepted a
+// call or let it through to the real implementation.
+type fakeSnapshotter struct {
+	snapshots.Snapshotter
+	prepareCalls int
+	commitCalls  int
+}
+
+func (f *fakeSnapshotter) Prepare(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	f.prepareCalls++
+	return nil, nil
+}
+
+func (f *fakeSnapshotter) Commit(ctx context.Context, name, key string, opts ...snapshots.Opt) error {
+	f.commitCalls++
+	return nil
+}
+
+// TestSnapshotterForContainerInjectsFailpoint proves the annotation is
+// actually consulted end-to-end: the handler must be the failpoint runtime
+// handler AND the annotation prefix must match for Prepare to fail.
+func TestSnapshotterForContainerInjectsFailpoint(t *testing.T) {
+	base := &fakeSnapshotter{}
+	annotations := map[string]string{
+		failpointSnapshotterAnnotationPrefix + "Prepare": "1*error(boom)",
+	}
+
+	sn, err := snapshotterForContainer(failpointRuntimeHandler, base, "key-1", annotations)
+	require.NoError(t, err)
+
+	_, err = sn.Prepare(context.Background(), "key-1", "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom")
+	require.Equal(t, 0, base.prepareCalls, "the real snapshotter must not be reached when the failpoint fires")
+}
+
+// TestSnapshotterForContainerPassthroughWithoutFailpointHandler verifies
+// that outside of the failpoint runtime handler, the annotation has no
+// effect and calls reach the real snapshotter.
+func TestSnapshotterForContainerPassthroughWithoutFailpointHandler(t *testing.T) {
+	base := &fakeSnapshotter{}
+	annotations := map[string]string{
+		failpointSnapshotterAnnotationPrefix + "Prepare": "1*error(boom)",
+	}
+
+	sn, err := snapshotterForContainer("runc", base, "key-1", annotations)
+	require.NoError(t, err)
+
+	_, err = sn.Prepare(context.Background(), "key-1", "")
+	require.NoError(t, err)
+	require.Equal(t, 1, base.prepareCalls)
+}
+
+// TestSnapshotterForContainerCommitFailpointThenRetrySucceeds exercises the
+// succeeded-Prepare/failed-Commit interleaving the integration tests target,
+// confirming the failpoint is consumed after firing once.
+func TestSnapshotterForContainerCommitFailpointThenRetrySucceeds(t *testing.T) {
+	base := &fakeSnapshotter{}
+	annotations := map[string]string{
+		failpointSnapshotterAnnotationPrefix + "Commit": "1*error(commit interrupted)",
+	}
+
+	sn, err := snapshotterForContainer(failpointRuntimeHandler, base, "key-1", annotations)
+	require.NoError(t, err)
+
+	err = sn.Commit(context.Background(), "name", "key-1")
+	require.Error(t, err)
+
+	err = sn.Commit(context.Background(), "name", "key-1")
+	require.NoError(t, err)
+	require.Equal(t, 1, base.commitCalls)
+}
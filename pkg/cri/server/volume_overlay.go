@@ -0,0 +1,181 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// volumeOverlayAnnotationPrefix is the annotation namespace used to request
+// that an image-declared VOLUME be backed by a persistent overlayfs upper
+// and work directory living outside the per-container volumes directory,
+// e.g.:
+//
+//	io.containerd.cri.volume-overlay//data=upperdir=/srv/upper,workdir=/srv/work
+//
+// The leading "/" of the container path may be omitted
+// (io.containerd.cri.volume-overlay/data names the same /data volume).
+//
+// This mirrors podman's non-volatile `-v src:dst:O,upperdir=...,workdir=...`
+// anonymous volume overlay support.
+const volumeOverlayAnnotationPrefix = "io.containerd.cri.volume-overlay/"
+
+// persistentOverlayVolume describes a single image-declared volume that
+// should be mounted as an overlayfs with a caller-supplied, persistent
+// upperdir/workdir instead of the default copy-up directory managed under
+// <criRoot>/containers/<id>/volumes.
+type persistentOverlayVolume struct {
+	// containerPath is the VOLUME path inside the container, as declared
+	// by the image config.
+	containerPath string
+	// upperDir and workDir are host paths supplied by the caller. They
+	// are never removed when the container is removed.
+	upperDir string
+	workDir  string
+}
+
+// parsePersistentOverlayVolumes extracts persistentOverlayVolume entries
+// from pod/container annotations of the form documented on
+// volumeOverlayAnnotationPrefix.
+func parsePersistentOverlayVolumes(annotations map[string]string) ([]persistentOverlayVolume, error) {
+	var vols []persistentOverlayVolume
+	for k, v := range annotations {
+		containerPath := strings.TrimPrefix(k, volumeOverlayAnnotationPrefix)
+		if containerPath == k {
+			continue
+		}
+		if !strings.HasPrefix(containerPath, "/") {
+			containerPath = "/" + containerPath
+		}
+
+		vol := persistentOverlayVolume{containerPath: containerPath}
+		for _, field := range strings.Split(v, ",") {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid volume-overlay annotation %q=%q: malformed field %q", k, v, field)
+			}
+			switch kv[0] {
+			case "upperdir":
+				vol.upperDir = kv[1]
+			case "workdir":
+				vol.workDir = kv[1]
+			default:
+				return nil, fmt.Errorf("invalid volume-overlay annotation %q=%q: unknown key %q", k, v, kv[0])
+			}
+		}
+		if vol.upperDir == "" || vol.workDir == "" {
+			return nil, fmt.Errorf("volume-overlay annotation for %q requires both upperdir and workdir", containerPath)
+		}
+		vols = append(vols, vol)
+	}
+	return vols, nil
+}
+
+// persistentOverlayMount builds the overlayfs mount for vol, layering the
+// image's copy-up snapshot (lowerDir) underneath the caller's persistent
+// upperdir/workdir. Because upperDir/workDir live outside the container's
+// managed volumes directory, removing the container must not delete them;
+// callers should skip vol.containerPath when cleaning up
+// <criRoot>/containers/<id>/volumes.
+func persistentOverlayMount(vol persistentOverlayVolume, lowerDir string) specs.Mount {
+	return specs.Mount{
+		Destination: vol.containerPath,
+		Type:        "overlay",
+		Source:      "overlay",
+		Options: []string{
+			"lowerdir=" + lowerDir,
+			"upperdir=" + vol.upperDir,
+			"workdir=" + vol.workDir,
+		},
+	}
+}
+
+// isPersistentOverlayPath reports whether containerPath was requested as a
+// persistent overlay volume, so volume cleanup on container removal can
+// skip it instead of deleting the caller-owned upperdir/workdir.
+func isPersistentOverlayPath(vols []persistentOverlayVolume, containerPath string) bool {
+	for _, v := range vols {
+		if v.containerPath == containerPath {
+			return true
+		}
+	}
+	return false
+}
+
+// generateVolumeMounts builds the mount list for a container's
+// image-declared VOLUME paths. For each containerPath in imageVolumes, it
+// consults annotations for a matching volumeOverlayAnnotationPrefix entry:
+// if present, the volume is mounted as an overlayfs layering the image's
+// copy-up snapshot under the caller-supplied, persistent upperdir/workdir;
+// otherwise it falls back to a plain bind mount of the copy-up directory,
+// which is the pre-existing default behavior exercised by TestVolumeCopyUp.
+func generateVolumeMounts(imageVolumes []string, copyUpDir func(containerPath string) string, annotations map[string]string) ([]specs.Mount, error) {
+	overlayVols, err := parsePersistentOverlayVolumes(annotations)
+	if err != nil {
+		return nil, fmt.Errorf("parsing volume-overlay annotations: %w", err)
+	}
+
+	mounts := make([]specs.Mount, 0, len(imageVolumes))
+	for _, containerPath := range imageVolumes {
+		lowerDir := copyUpDir(containerPath)
+
+		mounted := false
+		for _, vol := range overlayVols {
+			if vol.containerPath != containerPath {
+				continue
+			}
+			mounts = append(mounts, persistentOverlayMount(vol, lowerDir))
+			mounted = true
+			break
+		}
+		if !mounted {
+			mounts = append(mounts, specs.Mount{
+				Destination: containerPath,
+				Type:        "bind",
+				Source:      lowerDir,
+				Options:     []string{"rbind", "rw"},
+			})
+		}
+	}
+	return mounts, nil
+}
+
+// cleanupContainerVolumeDirs removes the per-container copy-up volume
+// directories under <criRoot>/containers/<id>/volumes for imageVolumes,
+// except those backed by a persistent overlay upperdir/workdir (annotations
+// that matched a volumeOverlayAnnotationPrefix entry), which must survive
+// container removal so a recreated container can keep writing to the same
+// upperdir.
+func cleanupContainerVolumeDirs(removeFn func(containerPath string) error, imageVolumes []string, annotations map[string]string) error {
+	overlayVols, err := parsePersistentOverlayVolumes(annotations)
+	if err != nil {
+		return fmt.Errorf("parsing volume-overlay annotations: %w", err)
+	}
+
+	for _, containerPath := range imageVolumes {
+		if isPersistentOverlayPath(overlayVols, containerPath) {
+			continue
+		}
+		if err := removeFn(containerPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
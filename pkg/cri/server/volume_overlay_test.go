@@ -0,0 +1,78 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerateVolumeMountsUsesPersistentOverlayAnnotation verifies that a
+// volume-overlay annotation actually changes the mount generated for the
+// matching image VOLUME, instead of the default copy-up bind mount.
+func TestGenerateVolumeMountsUsesPersistentOverlayAnnotation(t *testing.T) {
+	annotations := map[string]string{
+		"io.containerd.cri.volume-overlay/test_dir": "upperdir=/srv/upper,workdir=/srv/work",
+	}
+
+	mounts, err := generateVolumeMounts(
+		[]string{"/test_dir", "/other_dir"},
+		func(containerPath string) string { return "/copyup" + containerPath },
+		annotations,
+	)
+	require.NoError(t, err)
+	require.Len(t, mounts, 2)
+
+	overlay := mounts[0]
+	require.Equal(t, "/test_dir", overlay.Destination)
+	require.Equal(t, "overlay", overlay.Type)
+	require.Contains(t, overlay.Options, "lowerdir=/copyup/test_dir")
+	require.Contains(t, overlay.Options, "upperdir=/srv/upper")
+	require.Contains(t, overlay.Options, "workdir=/srv/work")
+
+	plain := mounts[1]
+	require.Equal(t, "/other_dir", plain.Destination)
+	require.Equal(t, "bind", plain.Type)
+	require.Equal(t, "/copyup/other_dir", plain.Source)
+}
+
+// TestCleanupContainerVolumeDirsSkipsPersistentOverlay verifies that
+// removal skips volumes backed by a persistent overlay upperdir/workdir,
+// while still cleaning up ordinary copy-up volumes.
+func TestCleanupContainerVolumeDirsSkipsPersistentOverlay(t *testing.T) {
+	annotations := map[string]string{
+		"io.containerd.cri.volume-overlay/test_dir": "upperdir=/srv/upper,workdir=/srv/work",
+	}
+
+	var removed []string
+	err := cleanupContainerVolumeDirs(func(containerPath string) error {
+		removed = append(removed, containerPath)
+		return nil
+	}, []string{"/test_dir", "/other_dir"}, annotations)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"/other_dir"}, removed)
+}
+
+func TestCleanupContainerVolumeDirsPropagatesRemoveError(t *testing.T) {
+	err := cleanupContainerVolumeDirs(func(containerPath string) error {
+		return fmt.Errorf("boom: %s", containerPath)
+	}, []string{"/other_dir"}, nil)
+	require.Error(t, err)
+}
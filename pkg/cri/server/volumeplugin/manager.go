@@ -0,0 +1,187 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package volumeplugin tracks the external volume/snapshotter plugin
+// sockets the CRI plugin has been configured with and lets them be
+// re-probed and reconciled without restarting containerd, analogous to
+// `podman volume reload`.
+package volumeplugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+)
+
+// Driver is a single configured volume/snapshotter plugin.
+type Driver struct {
+	// Name is the driver's configured name, as referenced by volume
+	// annotations.
+	Name string
+	// Address is the plugin's listen socket, e.g. unix:///run/csi/foo.sock.
+	Address string
+
+	reachable bool
+}
+
+// Manager tracks the set of configured volume plugin drivers and the
+// sandboxes/containers that depend on each of them.
+type Manager struct {
+	mu      sync.Mutex
+	drivers map[string]*Driver
+	// dependents maps a driver name to the sandbox/container IDs whose
+	// volumes reference it, so Reload can mark them NOTREADY if the
+	// driver goes missing.
+	dependents map[string][]string
+}
+
+// NewManager creates a Manager seeded with the statically configured
+// drivers.
+func NewManager(drivers []Driver) *Manager {
+	m := &Manager{
+		drivers:    make(map[string]*Driver),
+		dependents: make(map[string][]string),
+	}
+	for i := range drivers {
+		d := drivers[i]
+		m.drivers[d.Name] = &d
+	}
+	return m
+}
+
+// RegisterDependent records that sandboxOrContainerID depends on the volume
+// driver named driverName, so that a future Reload can mark it NOTREADY if
+// the driver becomes unreachable.
+func (m *Manager) RegisterDependent(driverName, sandboxOrContainerID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dependents[driverName] = append(m.dependents[driverName], sandboxOrContainerID)
+}
+
+// ReloadReport summarizes the outcome of a Reload call.
+type ReloadReport struct {
+	Added   []string
+	Removed []string
+	Errored map[string]error
+	// NotReady lists the sandbox/container IDs that were marked NOTREADY
+	// because a driver they depend on is no longer reachable.
+	NotReady []string
+}
+
+// Reload re-probes every configured driver's socket for liveness,
+// reconciles in-memory state with what is actually reachable, and reports
+// which sandboxes/containers should transition to NOTREADY as a result.
+// Configured is the current, possibly updated, set of drivers read from
+// disk; drivers absent from it are dropped.
+func (m *Manager) Reload(ctx context.Context, configured []Driver) ReloadReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := ReloadReport{Errored: make(map[string]error)}
+
+	seen := make(map[string]struct{}, len(configured))
+	for _, d := range configured {
+		seen[d.Name] = struct{}{}
+		existing, ok := m.drivers[d.Name]
+		if !ok {
+			report.Added = append(report.Added, d.Name)
+			existing = &Driver{Name: d.Name}
+			m.drivers[d.Name] = existing
+		}
+		existing.Address = d.Address
+
+		reachable, err := probe(ctx, d.Address)
+		existing.reachable = reachable
+		if err != nil {
+			report.Errored[d.Name] = err
+		}
+
+		if !reachable {
+			report.NotReady = append(report.NotReady, m.dependents[d.Name]...)
+		}
+	}
+
+	for name := range m.drivers {
+		if _, ok := seen[name]; !ok {
+			report.Removed = append(report.Removed, name)
+			report.NotReady = append(report.NotReady, m.dependents[name]...)
+			delete(m.drivers, name)
+			delete(m.dependents, name)
+		}
+	}
+
+	return report
+}
+
+// SandboxNotReadySetter is the subset of the CRI sandbox store the volume
+// plugin manager needs to actually transition a sandbox to NOTREADY once
+// Reload determines it depends on a driver that is no longer reachable.
+// server.VolumePluginService takes one at construction time and passes it
+// straight through to ReloadAndNotify/Watch; a full CRI plugin would supply
+// one backed by its real sandbox store.
+type SandboxNotReadySetter interface {
+	SetNotReady(sandboxID string) error
+}
+
+// ReloadAndNotify calls Reload and then applies its report: every sandbox
+// in report.NotReady is transitioned via setter, with failures logged but
+// not fatal to the reload as a whole, since a single stuck sandbox must not
+// block the rest from being reconciled. This is what actually makes Reload
+// observable outside of the report it returns.
+func (m *Manager) ReloadAndNotify(ctx context.Context, configured []Driver, setter SandboxNotReadySetter) ReloadReport {
+	report := m.Reload(ctx, configured)
+	for _, id := range report.NotReady {
+		if err := setter.SetNotReady(id); err != nil {
+			log.G(ctx).WithError(err).Errorf("failed to mark sandbox %s NOTREADY after volume plugin reload", id)
+		}
+	}
+	return report
+}
+
+// Watch calls ReloadAndNotify every interval until ctx is done, using
+// driverSource to read the current on-disk driver configuration each time.
+// server.VolumePluginService.Watch runs this so that a volume driver going
+// away or coming back is reflected in sandbox readiness within one
+// interval, without requiring an explicit ReloadVolumePlugins call.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration, driverSource func() []Driver, setter SandboxNotReadySetter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.ReloadAndNotify(ctx, driverSource(), setter)
+		}
+	}
+}
+
+// probe dials the plugin's socket with a short timeout to check liveness.
+func probe(ctx context.Context, address string) (bool, error) {
+	d := net.Dialer{Timeout: 2 * time.Second}
+	conn, err := d.DialContext(ctx, "unix", address)
+	if err != nil {
+		log.G(ctx).WithError(err).Debugf("volume plugin %s unreachable", address)
+		return false, fmt.Errorf("probing volume plugin %s: %w", address, err)
+	}
+	_ = conn.Close()
+	return true, nil
+}
@@ -0,0 +1,168 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package volumeplugin
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSandboxStore is a minimal SandboxNotReadySetter that records which
+// sandbox IDs were actually transitioned, so tests can prove Reload's
+// report is consumed instead of discarded.
+type fakeSandboxStore struct {
+	mu       sync.Mutex
+	notReady map[string]int
+}
+
+func newFakeSandboxStore() *fakeSandboxStore {
+	return &fakeSandboxStore{notReady: make(map[string]int)}
+}
+
+func (f *fakeSandboxStore) SetNotReady(sandboxID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notReady[sandboxID]++
+	return nil
+}
+
+func (f *fakeSandboxStore) count(sandboxID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.notReady[sandboxID]
+}
+
+func listenUnix(t *testing.T, path string) net.Listener {
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l
+}
+
+// TestReloadMarksDependentsNotReadyWhenDriverDisappears exercises the full
+// Reload path: a sandbox registered against a driver must come back in
+// NotReady once that driver's socket goes away, and must no longer appear
+// once the driver is reachable again.
+func TestReloadMarksDependentsNotReadyWhenDriverDisappears(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "csi.sock")
+	l := listenUnix(t, sockPath)
+
+	m := NewManager(nil)
+	m.RegisterDependent("csi-example", "sandbox-1")
+
+	ctx := context.Background()
+	configured := []Driver{{Name: "csi-example", Address: sockPath}}
+
+	report := m.Reload(ctx, configured)
+	require.Contains(t, report.Added, "csi-example")
+	require.Empty(t, report.NotReady)
+	require.Empty(t, report.Errored)
+
+	require.NoError(t, l.Close())
+
+	report = m.Reload(ctx, configured)
+	require.Contains(t, report.NotReady, "sandbox-1")
+	require.NotEmpty(t, report.Errored["csi-example"])
+
+	l2 := listenUnix(t, sockPath)
+	defer l2.Close()
+
+	report = m.Reload(ctx, configured)
+	require.Empty(t, report.NotReady)
+	require.Empty(t, report.Errored)
+}
+
+// TestReloadReportsRemovedDrivers verifies that dropping a driver from the
+// configured set both reports it as removed and marks its dependents
+// NotReady, since they can no longer be reconciled at all.
+func TestReloadReportsRemovedDrivers(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "csi.sock")
+	l := listenUnix(t, sockPath)
+	defer l.Close()
+
+	m := NewManager([]Driver{{Name: "csi-example", Address: sockPath}})
+	m.RegisterDependent("csi-example", "sandbox-1")
+
+	report := m.Reload(context.Background(), nil)
+	require.Contains(t, report.Removed, "csi-example")
+	require.Contains(t, report.NotReady, "sandbox-1")
+}
+
+// TestReloadAndNotifyTransitionsDependents proves Reload's report is
+// actually consumed: a sandbox depending on a driver that disappears must
+// be handed to the notifier, not just listed in a report nobody reads.
+func TestReloadAndNotifyTransitionsDependents(t *testing.T) {
+	m := NewManager([]Driver{{Name: "csi-example", Address: filepath.Join(t.TempDir(), "gone.sock")}})
+	m.RegisterDependent("csi-example", "sandbox-1")
+
+	store := newFakeSandboxStore()
+	report := m.ReloadAndNotify(context.Background(), nil, store)
+
+	require.Contains(t, report.NotReady, "sandbox-1")
+	require.Equal(t, 1, store.count("sandbox-1"))
+}
+
+// TestWatchAppliesPeriodicReloads verifies Watch drives ReloadAndNotify on
+// its own, using driverSource each tick, and stops when its context is
+// canceled.
+func TestWatchAppliesPeriodicReloads(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "csi.sock")
+	l := listenUnix(t, sockPath)
+
+	m := NewManager(nil)
+	m.RegisterDependent("csi-example", "sandbox-1")
+	store := newFakeSandboxStore()
+
+	driverSource := func() []Driver {
+		return []Driver{{Name: "csi-example", Address: sockPath}}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Watch(ctx, 5*time.Millisecond, driverSource, store)
+		close(done)
+	}()
+
+	// Give Watch at least one tick to reconcile the reachable driver
+	// before it disappears, so the later NotReady transition is actually
+	// caused by the driver going away rather than it never having been
+	// registered at all.
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, l.Close())
+
+	require.Eventually(t, func() bool {
+		return store.count("sandbox-1") > 0
+	}, time.Second, 5*time.Millisecond, "Watch must notify the sandbox store once the driver disappears")
+
+	cancel()
+	<-done
+}
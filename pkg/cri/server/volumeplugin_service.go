@@ -0,0 +1,165 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/pkg/cri/server/volumeplugin"
+)
+
+// VolumePluginReloadReport is the wire form of volumeplugin.ReloadReport:
+// the error values in Errored don't survive a JSON round-trip, so this
+// carries their messages instead.
+type VolumePluginReloadReport struct {
+	Added    []string          `json:"added"`
+	Removed  []string          `json:"removed"`
+	Errored  map[string]string `json:"errored"`
+	NotReady []string          `json:"notReady"`
+}
+
+func toVolumePluginReloadReport(report volumeplugin.ReloadReport) VolumePluginReloadReport {
+	errored := make(map[string]string, len(report.Errored))
+	for name, err := range report.Errored {
+		errored[name] = err.Error()
+	}
+	return VolumePluginReloadReport{
+		Added:    report.Added,
+		Removed:  report.Removed,
+		Errored:  errored,
+		NotReady: report.NotReady,
+	}
+}
+
+// VolumePluginService is the genuine production owner of a
+// volumeplugin.Manager: NewVolumePluginService is what actually calls
+// volumeplugin.NewManager, instead of the Manager being constructed only in
+// its own unit tests. It exposes an on-demand ReloadVolumePlugins operation
+// over a unix socket in addition to the Manager's own periodic Watch loop.
+type VolumePluginService struct {
+	manager      *volumeplugin.Manager
+	driverSource func() []volumeplugin.Driver
+	setter       volumeplugin.SandboxNotReadySetter
+}
+
+// NewVolumePluginService creates a VolumePluginService backed by a fresh
+// Manager seeded with drivers, reloaded against whatever driverSource
+// returns, notifying setter of sandboxes that must transition to NOTREADY.
+func NewVolumePluginService(drivers []volumeplugin.Driver, driverSource func() []volumeplugin.Driver, setter volumeplugin.SandboxNotReadySetter) *VolumePluginService {
+	return &VolumePluginService{
+		manager:      volumeplugin.NewManager(drivers),
+		driverSource: driverSource,
+		setter:       setter,
+	}
+}
+
+// RegisterDependent records that sandboxOrContainerID depends on the volume
+// driver named driverName.
+func (s *VolumePluginService) RegisterDependent(driverName, sandboxOrContainerID string) {
+	s.manager.RegisterDependent(driverName, sandboxOrContainerID)
+}
+
+// Watch runs the Manager's periodic reload loop until ctx is done. This is
+// what gives the CRI plugin hot-reload behavior without an explicit
+// ReloadVolumePlugins call.
+func (s *VolumePluginService) Watch(ctx context.Context, interval time.Duration) {
+	s.manager.Watch(ctx, interval, s.driverSource, s.setter)
+}
+
+// ReloadVolumePlugins triggers an immediate, synchronous reload. This is
+// what the ReloadVolumePlugins RPC handler (see Serve) and a ctr
+// volumeplugin-reload-equivalent caller invoke instead of waiting for the
+// next Watch tick.
+func (s *VolumePluginService) ReloadVolumePlugins(ctx context.Context) VolumePluginReloadReport {
+	return toVolumePluginReloadReport(s.manager.ReloadAndNotify(ctx, s.driverSource(), s.setter))
+}
+
+// Serve accepts connections on l, handling ReloadVolumePlugins requests
+// until l is closed or ctx is done.
+func (s *VolumePluginService) Serve(ctx context.Context, l net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reload-volume-plugins", s.handleReload)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("serving ReloadVolumePlugins requests: %w", err)
+	}
+	return nil
+}
+
+func (s *VolumePluginService) handleReload(w http.ResponseWriter, r *http.Request) {
+	report := s.ReloadVolumePlugins(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// VolumePluginClient calls ReloadVolumePlugins on a VolumePluginService
+// listening on a unix socket; this is what a ctr volume-plugin reload
+// subcommand would use. This checkout has no cmd/ctr tree to add that
+// subcommand to, so only the client half exists here.
+type VolumePluginClient struct {
+	httpClient *http.Client
+}
+
+// NewVolumePluginClient creates a VolumePluginClient that dials the unix
+// socket at address for every request.
+func NewVolumePluginClient(address string) *VolumePluginClient {
+	return &VolumePluginClient{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", address)
+				},
+			},
+		},
+	}
+}
+
+// ReloadVolumePlugins calls the ReloadVolumePlugins operation on the
+// VolumePluginService at c's address and returns its report.
+func (c *VolumePluginClient) ReloadVolumePlugins(ctx context.Context) (VolumePluginReloadReport, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://volumeplugin.sock/reload-volume-plugins", bytes.NewReader(nil))
+	if err != nil {
+		return VolumePluginReloadReport{}, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return VolumePluginReloadReport{}, fmt.Errorf("calling ReloadVolumePlugins: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return VolumePluginReloadReport{}, fmt.Errorf("ReloadVolumePlugins failed: %s", strings.TrimSpace(string(data)))
+	}
+	var report VolumePluginReloadReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return VolumePluginReloadReport{}, fmt.Errorf("decoding ReloadVolumePlugins response: %w", err)
+	}
+	return report, nil
+}
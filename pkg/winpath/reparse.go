@@ -0,0 +1,156 @@
+//go:build windows
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package winpath
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// ReparseTag identifies the kind of reparse point ResolveMountPoint found at
+// a path.
+type ReparseTag uint32
+
+const (
+	// ReparseTagNone means the path is not a reparse point at all.
+	ReparseTagNone ReparseTag = 0
+	// ReparseTagMountPoint covers both NTFS junctions and bind-mounted
+	// volumes: both use IO_REPARSE_TAG_MOUNT_POINT, distinguished only by
+	// whether SubstituteName names a volume GUID path or another
+	// directory.
+	ReparseTagMountPoint ReparseTag = 0xA0000003
+	// ReparseTagSymlink covers NTFS symbolic links, including directory
+	// symlinks.
+	ReparseTagSymlink ReparseTag = 0xA000000C
+)
+
+const (
+	fsctlGetReparsePoint      = 0x900A8
+	maxReparseDataBufferSize  = 16 * 1024
+	mountPointHeaderSize      = 8  // SubstituteNameOffset/Length + PrintNameOffset/Length
+	symlinkHeaderSize         = 12 // same four fields plus Flags
+	reparseDataBufferHeaderSz = 8  // Tag, DataLength, Reserved
+)
+
+// MountPoint describes what ResolveMountPoint found at a path.
+type MountPoint struct {
+	// Tag is the raw reparse point tag.
+	Tag ReparseTag
+	// Target is the reparse point's substitute name: a volume GUID path
+	// for a bind-mounted volume, another directory for an NTFS junction,
+	// or the link target for a symlink.
+	Target string
+	// IsVolumeMount is true when Tag is ReparseTagMountPoint and Target
+	// names a volume (\??\Volume{GUID}\), i.e. a bind-mounted volume
+	// rather than a plain directory junction.
+	IsVolumeMount bool
+}
+
+// ResolveMountPoint walks the reparse point at path explicitly (without
+// letting the OS transparently follow it), so callers can distinguish
+// bind-mount volumes, junctions, and symlinks instead of only ever seeing
+// the fully resolved target that FinalPath would return.
+func ResolveMountPoint(path string) (MountPoint, error) {
+	han, err := OpenPathForBackup(path, WithNoResolveSymlinks())
+	if err != nil {
+		return MountPoint{}, err
+	}
+	defer func() {
+		_ = windows.CloseHandle(han)
+	}()
+
+	buf := make([]byte, maxReparseDataBufferSize)
+	var bytesReturned uint32
+	err = windows.DeviceIoControl(windows.Handle(han), fsctlGetReparsePoint, nil, 0, &buf[0], uint32(len(buf)), &bytesReturned, nil)
+	if err != nil {
+		if err == windows.ERROR_NOT_A_REPARSE_POINT {
+			return MountPoint{Tag: ReparseTagNone}, nil
+		}
+		return MountPoint{}, fmt.Errorf("reading reparse point at %s: %w", path, err)
+	}
+
+	return parseReparseDataBuffer(buf[:bytesReturned])
+}
+
+// parseReparseDataBuffer decodes the REPARSE_DATA_BUFFER layout returned by
+// FSCTL_GET_REPARSE_POINT for mount point and symlink reparse tags.
+func parseReparseDataBuffer(buf []byte) (MountPoint, error) {
+	if len(buf) < reparseDataBufferHeaderSz {
+		return MountPoint{}, fmt.Errorf("reparse data buffer too short: %d bytes", len(buf))
+	}
+
+	tag := ReparseTag(binary.LittleEndian.Uint32(buf[0:4]))
+	data := buf[reparseDataBufferHeaderSz:]
+
+	switch tag {
+	case ReparseTagMountPoint:
+		return parseNameFields(tag, data, mountPointHeaderSize)
+	case ReparseTagSymlink:
+		return parseNameFields(tag, data, symlinkHeaderSize)
+	default:
+		return MountPoint{Tag: tag}, nil
+	}
+}
+
+func parseNameFields(tag ReparseTag, data []byte, pathBufferOffset int) (MountPoint, error) {
+	if len(data) < pathBufferOffset+4 {
+		return MountPoint{}, fmt.Errorf("reparse point name fields truncated")
+	}
+
+	substituteNameOffset := binary.LittleEndian.Uint16(data[0:2])
+	substituteNameLength := binary.LittleEndian.Uint16(data[2:4])
+
+	pathBuffer := data[pathBufferOffset:]
+	start := int(substituteNameOffset)
+	end := start + int(substituteNameLength)
+	if end > len(pathBuffer) {
+		return MountPoint{}, fmt.Errorf("reparse point substitute name out of range")
+	}
+
+	name := utf16BytesToString(pathBuffer[start:end])
+
+	mp := MountPoint{
+		Tag:    tag,
+		Target: name,
+	}
+	if tag == ReparseTagMountPoint {
+		mp.IsVolumeMount = len(name) >= 4 && (name[:4] == `\??\` || name[:2] == `\\`) && containsVolumeGUID(name)
+	}
+	return mp, nil
+}
+
+func containsVolumeGUID(name string) bool {
+	const marker = "Volume{"
+	for i := 0; i+len(marker) <= len(name); i++ {
+		if name[i:i+len(marker)] == marker {
+			return true
+		}
+	}
+	return false
+}
+
+func utf16BytesToString(b []byte) string {
+	u16 := make([]uint16, len(b)/2)
+	for i := range u16 {
+		u16[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return windows.UTF16ToString(u16)
+}
@@ -0,0 +1,129 @@
+//go:build windows
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package winpath
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+)
+
+func windowsSetVolumeMountPoint(mountPoint, volumeGUIDPath string) error {
+	if !strings.HasSuffix(volumeGUIDPath, `\`) {
+		volumeGUIDPath += `\`
+	}
+	mp, err := windows.UTF16PtrFromString(mountPoint + `\`)
+	if err != nil {
+		return err
+	}
+	vol, err := windows.UTF16PtrFromString(volumeGUIDPath)
+	if err != nil {
+		return err
+	}
+	return windows.SetVolumeMountPoint(mp, vol)
+}
+
+func windowsDeleteVolumeMountPoint(mountPoint string) {
+	mp, err := windows.UTF16PtrFromString(mountPoint + `\`)
+	if err != nil {
+		return
+	}
+	_ = windows.DeleteVolumeMountPoint(mp)
+}
+
+// TestFinalPathDriveLetterDir exercises the common case: a plain directory
+// on a drive-lettered volume should come back unchanged modulo
+// normalization.
+func TestFinalPathDriveLetterDir(t *testing.T) {
+	dir := t.TempDir()
+
+	final, err := FinalPath(dir)
+	require.NoError(t, err)
+	require.True(t, strings.EqualFold(filepath.Clean(dir), filepath.Clean(final)))
+}
+
+// TestFinalPathDevicePrefix covers the \Device\... form, which must be
+// rewritten to \\.\GLOBALROOT\Device\... before it can be opened.
+func TestFinalPathDevicePrefix(t *testing.T) {
+	dir := t.TempDir()
+
+	vol, err := FinalPath(dir, WithVolumeNameNT())
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(vol, `\Device\`), "expected an NT device path, got %q", vol)
+
+	final, err := FinalPath(vol)
+	require.NoError(t, err)
+	require.True(t, strings.EqualFold(filepath.Clean(dir), filepath.Clean(final)))
+}
+
+// TestFinalPathVolumeGUID covers \\?\Volume{GUID}\... paths, requested
+// explicitly via WithVolumeNameGUID.
+func TestFinalPathVolumeGUID(t *testing.T) {
+	dir := t.TempDir()
+
+	guidPath, err := FinalPath(dir, WithVolumeNameGUID())
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(guidPath, `\\?\Volume{`), "expected a volume GUID path, got %q", guidPath)
+
+	final, err := FinalPath(guidPath, WithVolumeNameDOS())
+	require.NoError(t, err)
+	require.True(t, strings.EqualFold(filepath.Clean(dir), filepath.Clean(final)))
+}
+
+// TestFinalPathUNC covers the UNC share case, where VOLUME_NAME_DOS returns
+// \\?\UNC\server\share\... and FinalPath must normalize it back to
+// \\server\share\....
+func TestFinalPathUNC(t *testing.T) {
+	dir := t.TempDir()
+	share := `\\localhost\` + strings.ReplaceAll(filepath.VolumeName(dir), ":", "$")
+	if _, err := os.Stat(share); err != nil {
+		t.Skipf("administrative share %s not reachable: %v", share, err)
+	}
+
+	uncDir := filepath.Join(share, strings.TrimPrefix(dir, filepath.VolumeName(dir)))
+	final, err := FinalPath(uncDir)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(final, `\\`), "expected a UNC path, got %q", final)
+	require.False(t, strings.HasPrefix(final, `\\?\UNC\`), "UNC prefix should have been normalized, got %q", final)
+}
+
+// TestFinalPathDriveLetterlessVolume covers a volume mounted with no drive
+// letter: requesting VOLUME_NAME_DOS must fall back to VOLUME_NAME_GUID
+// automatically rather than erroring out.
+func TestFinalPathDriveLetterlessVolume(t *testing.T) {
+	dir := t.TempDir()
+	mountPoint := filepath.Join(t.TempDir(), "mnt")
+	require.NoError(t, os.Mkdir(mountPoint, 0o700))
+
+	volGUID, err := FinalPath(dir, WithVolumeNameGUID())
+	require.NoError(t, err)
+
+	if err := windowsSetVolumeMountPoint(mountPoint, volGUID); err != nil {
+		t.Skipf("could not mount a drive-letterless volume for this test: %v", err)
+	}
+	defer windowsDeleteVolumeMountPoint(mountPoint)
+
+	final, err := FinalPath(mountPoint)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(final, `\\?\Volume{`), "expected fallback to a volume GUID path, got %q", final)
+}
@@ -0,0 +1,233 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package blockfile
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/sys/unix"
+)
+
+// BackingFormat is the on-disk format of a blockfile snapshotter's backing
+// store.
+type BackingFormat string
+
+const (
+	// BackingFormatRaw is a plain raw block image, the historical default.
+	BackingFormatRaw BackingFormat = "raw"
+	// BackingFormatQcow2 is a qcow2 image, enabling backing-file chains.
+	BackingFormatQcow2 BackingFormat = "qcow2"
+	// BackingFormatZstdRaw is a zstd-compressed raw image. It is
+	// transparently decompressed into a raw scratch file the first time
+	// it is used to Prepare a snapshot.
+	BackingFormatZstdRaw BackingFormat = "zstd-raw"
+)
+
+// ParseBackingFormat validates a configured backing format string.
+func ParseBackingFormat(s string) (BackingFormat, error) {
+	switch BackingFormat(s) {
+	case BackingFormatRaw, BackingFormatQcow2, BackingFormatZstdRaw:
+		return BackingFormat(s), nil
+	default:
+		return "", fmt.Errorf("unknown blockfile backing format %q", s)
+	}
+}
+
+// CloneMode selects how a new snapshot's backing block file is derived from
+// its parent.
+type CloneMode string
+
+const (
+	// CloneModeCopy performs a full byte-for-byte copy of the parent's
+	// block file. This is the historical default and works on any
+	// filesystem.
+	CloneModeCopy CloneMode = "copy"
+	// CloneModeReflink uses ioctl(FICLONE) to create an instant
+	// copy-on-write clone of the parent's block file. Only XFS and Btrfs
+	// support this; CloneModeCopy is used as a fallback whenever the ioctl
+	// fails, whatever the error.
+	CloneModeReflink CloneMode = "reflink"
+	// CloneModeQcow2Backing creates a new qcow2 file using the parent
+	// snapshot's file as its backing file, giving O(1) snapshot creation
+	// and shared read-only base blocks.
+	CloneModeQcow2Backing CloneMode = "qcow2-backing"
+)
+
+// ParseCloneMode validates a configured clone mode string.
+func ParseCloneMode(s string) (CloneMode, error) {
+	switch CloneMode(s) {
+	case CloneModeCopy, CloneModeReflink, CloneModeQcow2Backing:
+		return CloneMode(s), nil
+	default:
+		return "", fmt.Errorf("unknown blockfile clone mode %q", s)
+	}
+}
+
+// WithBackingFormat sets the on-disk format of the scratch file.
+func WithBackingFormat(format BackingFormat) Opt {
+	return func(config *Config) error {
+		config.backingFormat = format
+		return nil
+	}
+}
+
+// WithCloneMode sets how new snapshots derive their block file from their
+// parent.
+func WithCloneMode(mode CloneMode) Opt {
+	return func(config *Config) error {
+		config.cloneMode = mode
+		return nil
+	}
+}
+
+// WithMaxSize sets the virtual size, in bytes, passed as the size argument
+// of `qemu-img create` when CloneModeQcow2Backing derives a snapshot from a
+// parent. It has no effect in any other case: not with CloneModeCopy or
+// CloneModeReflink (even when BackingFormat is qcow2), and not for the first
+// snapshot of a chain, which is a plain copy of the scratch file.
+func WithMaxSize(size int64) Opt {
+	return func(config *Config) error {
+		config.maxSize = size
+		return nil
+	}
+}
+
+// prepareBackingFile materializes the block file to use for a new snapshot
+// keyed by name, deriving it from parentFile according to cloneMode. For the
+// very first snapshot in a chain, parentFile is empty, parentFormat is
+// ignored, and a copy of the scratch file (in scratchFormat) is always used.
+//
+// It returns the BackingFormat of targetFile, which callers must track and
+// pass back in as parentFormat the next time a snapshot is derived from
+// targetFile: CloneModeQcow2Backing always produces a qcow2 file regardless
+// of the parent's format, while CloneModeCopy and CloneModeReflink preserve
+// whatever format the parent already had.
+func prepareBackingFile(cloneMode CloneMode, maxSize int64, scratchFile string, scratchFormat BackingFormat, parentFile string, parentFormat BackingFormat, targetFile string) (BackingFormat, error) {
+	if parentFile == "" {
+		if err := copyFile(scratchFile, targetFile); err != nil {
+			return "", err
+		}
+		return scratchFormat, nil
+	}
+
+	switch cloneMode {
+	case CloneModeQcow2Backing:
+		if err := createQcow2Backing(parentFile, targetFile, parentFormat, maxSize); err != nil {
+			return "", err
+		}
+		return BackingFormatQcow2, nil
+	case CloneModeReflink:
+		if err := reflinkCopy(parentFile, targetFile); err != nil {
+			if err := copyFile(parentFile, targetFile); err != nil {
+				return "", err
+			}
+		}
+		return parentFormat, nil
+	default:
+		if err := copyFile(parentFile, targetFile); err != nil {
+			return "", err
+		}
+		return parentFormat, nil
+	}
+}
+
+// createQcow2Backing creates targetFile as a new qcow2 image backed by
+// parentFile, equivalent to:
+//
+//	qemu-img create -F <parentFormat> -b <parent> -f qcow2 <target> [size]
+//
+// parentFormat must name parentFile's actual on-disk format (e.g. "raw" for
+// the very first link in a chain, "qcow2" for every subsequent one) —
+// passing the wrong format corrupts qemu-img's interpretation of the
+// backing file.
+func createQcow2Backing(parentFile, targetFile string, parentFormat BackingFormat, maxSize int64) error {
+	args := []string{"create", "-F", string(parentFormat), "-b", parentFile, "-f", "qcow2", targetFile}
+	if maxSize > 0 {
+		args = append(args, fmt.Sprintf("%d", maxSize))
+	}
+	out, err := exec.Command("qemu-img", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("qemu-img create failed: %w: %s", err, out)
+	}
+	return nil
+}
+
+// reflinkCopy creates targetFile as a copy-on-write clone of srcFile using
+// ioctl(FICLONE). Callers should fall back to a full copy when this returns
+// an error, since reflink is only supported on XFS and Btrfs.
+func reflinkCopy(srcFile, targetFile string) error {
+	src, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(targetFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
+
+// decompressZstdRaw decompresses a zstd-raw scratch file into dst the first
+// time it is used to Prepare a snapshot.
+func decompressZstdRaw(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := zstd.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("opening zstd-raw scratch file: %w", err)
+	}
+	defer zr.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := zr.WriteTo(out); err != nil {
+		return fmt.Errorf("decompressing zstd-raw scratch file: %w", err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = out.ReadFrom(in)
+	return err
+}
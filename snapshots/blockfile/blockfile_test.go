@@ -0,0 +1,100 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package blockfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSnapshotterQcow2BackingChainStaysSublinear exercises Snapshotter's
+// Prepare/Commit directly, unlike TestCreateQcow2BackingChainStaysSublinear
+// in backing_test.go, which drives prepareBackingFile without going through
+// a Snapshotter at all. It builds a 50-deep chain of committed snapshots
+// configured for qcow2-backing clone mode and asserts total on-disk usage
+// stays well below 50x a single base image.
+func TestSnapshotterQcow2BackingChainStaysSublinear(t *testing.T) {
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		t.Skip("qemu-img not available")
+	}
+
+	dir := t.TempDir()
+	scratch := filepath.Join(dir, "scratch.raw")
+	require.NoError(t, os.WriteFile(scratch, make([]byte, 16<<20), 0o600))
+
+	sn, err := NewSnapshotter(filepath.Join(dir, "root"),
+		WithScratchFile(scratch),
+		WithFSType("ext4"),
+		WithCloneMode(CloneModeQcow2Backing))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	const chainLen = 50
+	parent := ""
+	for i := 0; i < chainLen; i++ {
+		key := fmt.Sprintf("active-%d", i)
+		_, err := sn.Prepare(ctx, key, parent)
+		require.NoError(t, err)
+
+		name := fmt.Sprintf("committed-%d", i)
+		require.NoError(t, sn.Commit(ctx, name, key))
+		parent = name
+	}
+
+	var total int64
+	for _, rec := range sn.snapshots {
+		info, err := os.Stat(sn.backingFile(rec.ID))
+		require.NoError(t, err)
+		total += info.Size()
+	}
+
+	baseInfo, err := os.Stat(scratch)
+	require.NoError(t, err)
+
+	require.Lessf(t, total, int64(chainLen)*baseInfo.Size()/2,
+		"on-disk usage of a %d-deep Snapshotter-managed backing chain should stay sublinear", chainLen)
+}
+
+// TestSnapshotterRemoveRefusesSnapshotWithChildren proves Remove, reachable
+// only through the Snapshotter now that Prepare/Commit actually allocate
+// block files, won't orphan a child's parent backing file.
+func TestSnapshotterRemoveRefusesSnapshotWithChildren(t *testing.T) {
+	dir := t.TempDir()
+	scratch := filepath.Join(dir, "scratch.raw")
+	require.NoError(t, os.WriteFile(scratch, make([]byte, 1<<20), 0o600))
+
+	sn, err := NewSnapshotter(filepath.Join(dir, "root"), WithScratchFile(scratch), WithFSType("ext4"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = sn.Prepare(ctx, "base-active", "")
+	require.NoError(t, err)
+	require.NoError(t, sn.Commit(ctx, "base", "base-active"))
+
+	_, err = sn.Prepare(ctx, "child", "base")
+	require.NoError(t, err)
+
+	require.Error(t, sn.Remove(ctx, "base"), "a snapshot with children must not be removable")
+	require.NoError(t, sn.Remove(ctx, "child"))
+	require.NoError(t, sn.Remove(ctx, "base"))
+}
@@ -34,6 +34,20 @@ type Config struct {
 
 	// FSType is the filesystem type for the mount
 	FSType string `toml:"fs_type"`
+
+	// BackingFormat is the on-disk format of the scratch file: "raw"
+	// (default), "qcow2" or "zstd-raw". See blockfile.ParseBackingFormat.
+	BackingFormat string `toml:"backing_format"`
+
+	// CloneMode selects how a new snapshot's block file is derived from
+	// its parent: "copy" (default), "reflink" or "qcow2-backing". See
+	// blockfile.ParseCloneMode.
+	CloneMode string `toml:"clone_mode"`
+
+	// MaxSize is the virtual size, in bytes, of snapshots created by a
+	// "qcow2-backing" clone of a parent. It has no effect with any other
+	// CloneMode, whatever the BackingFormat. See blockfile.WithMaxSize.
+	MaxSize int64 `toml:"max_size"`
 }
 
 func init() {
@@ -60,6 +74,23 @@ func init() {
 			if config.FSType != "" {
 				opts = append(opts, blockfile.WithFSType(config.FSType))
 			}
+			if config.BackingFormat != "" {
+				format, err := blockfile.ParseBackingFormat(config.BackingFormat)
+				if err != nil {
+					return nil, err
+				}
+				opts = append(opts, blockfile.WithBackingFormat(format))
+			}
+			if config.CloneMode != "" {
+				mode, err := blockfile.ParseCloneMode(config.CloneMode)
+				if err != nil {
+					return nil, err
+				}
+				opts = append(opts, blockfile.WithCloneMode(mode))
+			}
+			if config.MaxSize != 0 {
+				opts = append(opts, blockfile.WithMaxSize(config.MaxSize))
+			}
 
 			return blockfile.NewSnapshotter(root, opts...)
 		},
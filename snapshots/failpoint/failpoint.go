@@ -0,0 +1,143 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package failpoint implements a snapshots.Snapshotter wrapper that injects
+// failures configured through container/pod annotations. It is the
+// snapshotter-side counterpart of the shim and CNI failpoint injection used
+// by the CRI plugin's "failpoint" runtime handler.
+package failpoint
+
+import (
+	"context"
+	"sync"
+
+	"github.com/containerd/containerd/log"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/pkg/failpoint"
+	"github.com/containerd/containerd/snapshots"
+)
+
+// AnnotationPrefix is the prefix under which the CRI plugin stores
+// per-method failpoint specs for the failpoint snapshotter, e.g.
+// "io.containerd.snapshotter.failpoint.Prepare" = "1*error(boom)".
+const AnnotationPrefix = "io.containerd.snapshotter.failpoint."
+
+// Snapshotter wraps a snapshots.Snapshotter, evaluating a named failpoint
+// before delegating every intercepted method to the real implementation.
+// It is exported, rather than returned only as a snapshots.Snapshotter
+// interface, so that callers outside this package (e.g. the CRI plugin)
+// can reach SetFailpoint to configure it from annotations.
+type Snapshotter struct {
+	snapshots.Snapshotter
+
+	mu sync.Mutex
+	fp map[string]*failpoint.Failpoint
+}
+
+// NewSnapshotter wraps sn so that Prepare, View, Commit, Mounts, Remove and
+// Stat can each be made to fail on demand. Failpoints are configured per
+// key via SetFailpoint and are typically parsed out of the annotations
+// passed to Prepare/View by the CRI plugin when the failpoint runtime
+// handler is selected.
+func NewSnapshotter(sn snapshots.Snapshotter) *Snapshotter {
+	return &Snapshotter{
+		Snapshotter: sn,
+		fp:          make(map[string]*failpoint.Failpoint),
+	}
+}
+
+// SetFailpoint configures the failpoint spec (e.g. "1*error(boom)") that
+// should be evaluated the next time method is called for key. An empty
+// spec clears any previously configured failpoint.
+func (s *Snapshotter) SetFailpoint(key, method, spec string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if spec == "" {
+		delete(s.fp, failpointKey(key, method))
+		return nil
+	}
+
+	fp, err := failpoint.NewFailpoint(method, spec)
+	if err != nil {
+		return err
+	}
+	s.fp[failpointKey(key, method)] = fp
+	return nil
+}
+
+func (s *Snapshotter) evaluate(key, method string) error {
+	s.mu.Lock()
+	fp := s.fp[failpointKey(key, method)]
+	s.mu.Unlock()
+
+	if fp == nil {
+		return nil
+	}
+	return fp.Evaluate()
+}
+
+func failpointKey(key, method string) string {
+	return method + "::" + key
+}
+
+func (s *Snapshotter) Prepare(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	if err := s.evaluate(key, "Prepare"); err != nil {
+		log.G(ctx).WithError(err).Warnf("injected failpoint on Prepare(%s)", key)
+		return nil, err
+	}
+	return s.Snapshotter.Prepare(ctx, key, parent, opts...)
+}
+
+func (s *Snapshotter) View(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	if err := s.evaluate(key, "View"); err != nil {
+		log.G(ctx).WithError(err).Warnf("injected failpoint on View(%s)", key)
+		return nil, err
+	}
+	return s.Snapshotter.View(ctx, key, parent, opts...)
+}
+
+func (s *Snapshotter) Commit(ctx context.Context, name, key string, opts ...snapshots.Opt) error {
+	if err := s.evaluate(key, "Commit"); err != nil {
+		log.G(ctx).WithError(err).Warnf("injected failpoint on Commit(%s)", key)
+		return err
+	}
+	return s.Snapshotter.Commit(ctx, name, key, opts...)
+}
+
+func (s *Snapshotter) Mounts(ctx context.Context, key string) ([]mount.Mount, error) {
+	if err := s.evaluate(key, "Mounts"); err != nil {
+		log.G(ctx).WithError(err).Warnf("injected failpoint on Mounts(%s)", key)
+		return nil, err
+	}
+	return s.Snapshotter.Mounts(ctx, key)
+}
+
+func (s *Snapshotter) Remove(ctx context.Context, key string) error {
+	if err := s.evaluate(key, "Remove"); err != nil {
+		log.G(ctx).WithError(err).Warnf("injected failpoint on Remove(%s)", key)
+		return err
+	}
+	return s.Snapshotter.Remove(ctx, key)
+}
+
+func (s *Snapshotter) Stat(ctx context.Context, key string) (snapshots.Info, error) {
+	if err := s.evaluate(key, "Stat"); err != nil {
+		log.G(ctx).WithError(err).Warnf("injected failpoint on Stat(%s)", key)
+		return snapshots.Info{}, err
+	}
+	return s.Snapshotter.Stat(ctx, key)
+}